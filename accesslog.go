@@ -0,0 +1,66 @@
+package sse
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+var disconnectReasonNames = []string{
+	DisconnectServerClosed: "server_closed",
+	DisconnectClientClosed: "client_closed",
+	DisconnectSlowClient:   "slow_client",
+	DisconnectKicked:       "kicked",
+	DisconnectWriteFailed:  "write_failed",
+	DisconnectMaxDuration:  "max_duration",
+	DisconnectDrained:      "drained",
+	DisconnectInitFailed:   "init_failed",
+}
+
+// String returns a short name for the reason, such as "client_closed".
+func (r DisconnectReason) String() string {
+	if r < 0 || int(r) >= len(disconnectReasonNames) {
+		return "DisconnectReason(" + strconv.Itoa(int(r)) + ")"
+	}
+	return disconnectReasonNames[r]
+}
+
+// NewAccessLogFn creates a function suitable for DisconnectedFn in
+// HandlerConfig that writes a line to w for each connection that ends, the
+// event stream equivalent of an HTTP access log. The line contains the
+// remote address, the value returned by ConnectedFn, the connection time and
+// duration, the number of events and bytes written, and the reason the
+// connection ended, formatted as key=value pairs. Writes to w are serialized.
+func NewAccessLogFn(w io.Writer) func(*DisconnectInfo) {
+	var mutex sync.Mutex
+	return func(i *DisconnectInfo) {
+		line := fmt.Sprintf(
+			"id=%d remote_addr=%q value=%q connected_at=%s duration=%s events=%d bytes=%d reason=%s\n",
+			i.ID,
+			i.RemoteAddr,
+			fmt.Sprint(i.Value),
+			i.ConnectedAt.UTC().Format(time.RFC3339),
+			i.Duration,
+			i.EventsSent,
+			i.BytesWritten,
+			i.Reason,
+		)
+		defer mutex.Unlock()
+		mutex.Lock()
+		io.WriteString(w, line)
+	}
+}
@@ -0,0 +1,60 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewAccessLogFn(t *testing.T) {
+	var (
+		b  = &bytes.Buffer{}
+		fn = NewAccessLogFn(b)
+	)
+	fn(&DisconnectInfo{
+		ConnectionInfo: ConnectionInfo{
+			ID:          1,
+			RemoteAddr:  "127.0.0.1:1234",
+			ConnectedAt: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+			Value:       "user",
+		},
+		Duration:     time.Second,
+		EventsSent:   2,
+		BytesWritten: 20,
+		Reason:       DisconnectClientClosed,
+	})
+	var (
+		line   = b.String()
+		output = `id=1 remote_addr="127.0.0.1:1234" value="user" connected_at=2023-01-02T03:04:05Z duration=1s events=2 bytes=20 reason=client_closed` + "\n"
+	)
+	if line != output {
+		t.Fatalf("%#v != %#v", line, output)
+	}
+}
+
+func TestHandlerBytesWritten(t *testing.T) {
+	infoChan := make(chan *DisconnectInfo, 1)
+	h := NewHandler(&HandlerConfig{
+		InitFn: func(any) []*Event {
+			return []*Event{{Data: "x"}}
+		},
+		DisconnectedFn: func(i *DisconnectInfo) {
+			infoChan <- i
+		},
+	})
+	defer h.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	)
+	h.ServeHTTP(w, r)
+	i := <-infoChan
+	if i.EventsSent != 1 || i.BytesWritten != int64(w.Body.Len()) {
+		t.Fatalf("unexpected info %+v", i)
+	}
+}
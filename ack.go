@@ -0,0 +1,171 @@
+package sse
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+
+	// maxAckSize limits the size of the request body accepted by AckHandler.
+	maxAckSize = 1024
+
+	defaultAckCursorTTL = 24 * time.Hour
+)
+
+// cursorKey identifies the acknowledgment cursor of a client in a stream.
+type cursorKey struct {
+	stream string
+	client string
+}
+
+// cursor is the ID of the last event acknowledged by a client along with the
+// time it was last used.
+type cursor struct {
+	id     string
+	usedAt time.Time
+}
+
+// ackCursorTTL returns AckCursorTTL or its default value.
+func (h *Handler) ackCursorTTL() time.Duration {
+	if h.cfg.AckCursorTTL > 0 {
+		return h.cfg.AckCursorTTL
+	}
+	return defaultAckCursorTTL
+}
+
+// sweepCursors discards cursors that have expired. To avoid examining every
+// cursor on each acknowledgment, it does nothing if a sweep was performed
+// within the last TTL. Cursors are not checked against the store, which would
+// require reading it for each cursor while the mutex is held; a cursor
+// pointing to an event that is no longer stored is treated like any other
+// unknown Last-Event-ID when it is used. The mutex must be held when calling
+// this method.
+func (h *Handler) sweepCursors(now time.Time) {
+	ttl := h.ackCursorTTL()
+	if now.Sub(h.lastSweep) < ttl {
+		return
+	}
+	h.lastSweep = now
+	for k, c := range h.cursors {
+		if now.Sub(c.usedAt) >= ttl {
+			delete(h.cursors, k)
+		}
+	}
+}
+
+// ackCursor returns the ID of the last event acknowledged by the client
+// making the request, or an empty string if it has not acknowledged any.
+func (h *Handler) ackCursor(stream string, r *http.Request) string {
+	if h.cfg.AckKeyFn == nil {
+		return ""
+	}
+	client := h.cfg.AckKeyFn(r)
+	if client == "" {
+		return ""
+	}
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	c, ok := h.cursors[cursorKey{stream, client}]
+	if !ok {
+		return ""
+	}
+	now := time.Now()
+	if now.Sub(c.usedAt) >= h.ackCursorTTL() {
+		delete(h.cursors, cursorKey{stream, client})
+		return ""
+	}
+	c.usedAt = now
+	return c.id
+}
+
+// AckHandler returns an http.Handler that clients POST the ID of the last
+// event they processed to. The body of the request is the event ID. When the
+// client reconnects, events after the acknowledged one are replayed in place
+// of those after its Last-Event-ID, providing at-least-once delivery.
+// AckKeyFn must be set in HandlerConfig to identify clients.
+func (h *Handler) AckHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(
+				w,
+				http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed,
+			)
+			return
+		}
+		if !h.trustedOrigin(r) {
+			http.Error(
+				w,
+				http.StatusText(http.StatusForbidden),
+				http.StatusForbidden,
+			)
+			return
+		}
+		if h.cfg.AuthFn != nil {
+			authValue, err := h.cfg.AuthFn(r)
+			if err != nil {
+				writeHTTPError(w, err, http.StatusUnauthorized)
+				return
+			}
+			r = r.WithContext(context.WithValue(r.Context(), authValueKey{}, authValue))
+		}
+		var client string
+		if h.cfg.AckKeyFn != nil {
+			client = h.cfg.AckKeyFn(r)
+		}
+		if client == "" {
+			http.Error(
+				w,
+				http.StatusText(http.StatusForbidden),
+				http.StatusForbidden,
+			)
+			return
+		}
+		b, err := io.ReadAll(io.LimitReader(r.Body, maxAckSize))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id := strings.TrimSpace(string(b))
+		if id == "" {
+			http.Error(w, "missing event ID", http.StatusBadRequest)
+			return
+		}
+		id, ok := h.verifyID(h.resumeBinding(r), id)
+		if !ok {
+			http.Error(w, errInvalidResumeToken.Error(), http.StatusBadRequest)
+			return
+		}
+		stream := h.streamFor(r)
+		func() {
+			defer h.mutex.Unlock()
+			h.mutex.Lock()
+			now := time.Now()
+			h.sweepCursors(now)
+			h.cursors[cursorKey{stream, client}] = &cursor{
+				id:     id,
+				usedAt: now,
+			}
+		}()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// Cursors returns the ID of the last event acknowledged by each client in
+// the stream, keyed by the value returned by AckKeyFn.
+func (h *Handler) Cursors(stream string) map[string]string {
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	cursors := make(map[string]string)
+	for k, c := range h.cursors {
+		if k.stream == stream {
+			cursors[k.client] = c.id
+		}
+	}
+	return cursors
+}
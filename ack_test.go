@@ -0,0 +1,124 @@
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAckHandler(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 10,
+		AckKeyFn: func(r *http.Request) string {
+			return r.Header.Get("X-Client")
+		},
+	})
+	defer h.Close()
+	for _, id := range []string{"1", "2", "3"} {
+		h.Send(&Event{ID: id})
+	}
+	for _, v := range []struct {
+		Name       string
+		Method     string
+		Client     string
+		Body       string
+		StatusCode int
+	}{
+		{
+			Name:       "wrong method",
+			Method:     http.MethodGet,
+			Client:     "a",
+			StatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			Name:       "unknown client",
+			Method:     http.MethodPost,
+			Body:       "1",
+			StatusCode: http.StatusForbidden,
+		},
+		{
+			Name:       "missing ID",
+			Method:     http.MethodPost,
+			Client:     "a",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Name:       "acknowledge",
+			Method:     http.MethodPost,
+			Client:     "a",
+			Body:       "1\n",
+			StatusCode: http.StatusNoContent,
+		},
+	} {
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(v.Method, "/ack", strings.NewReader(v.Body))
+		)
+		r.Header.Set("X-Client", v.Client)
+		h.AckHandler().ServeHTTP(w, r)
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+	}
+	if c, v := h.Cursors(""), map[string]string{"a": "1"}; !reflect.DeepEqual(c, v) {
+		t.Fatalf("%#v != %#v", c, v)
+	}
+
+	// Reconnect and confirm that events after the acknowledged one are
+	// replayed even though a later event was received
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	)
+	r.Header.Set("X-Client", "a")
+	r.Header.Set("Last-Event-ID", "3")
+	h.ServeHTTP(w, r)
+	if b, v := w.Body.String(), "id:2\rdata:\r\rid:3\rdata:\r\r"; b != v {
+		t.Fatalf("%#v != %#v", b, v)
+	}
+}
+
+func TestAckCursorEviction(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 2,
+		AckKeyFn: func(r *http.Request) string {
+			return r.Header.Get("X-Client")
+		},
+		AckCursorTTL: CLIENT_DELAY,
+	})
+	defer h.Close()
+	ack := func(client, id string) {
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodPost, "/ack", strings.NewReader(id))
+		)
+		r.Header.Set("X-Client", client)
+		h.AckHandler().ServeHTTP(w, r)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("%#v != %#v", w.Code, http.StatusNoContent)
+		}
+	}
+	h.Send(&Event{ID: "1"})
+	h.Send(&Event{ID: "2"})
+
+	// The cursor of "a" expires while the event it points to is still
+	// stored; the event that the cursor of "c" points to is trimmed but the
+	// cursor is kept until it expires
+	ack("a", "2")
+	time.Sleep(CLIENT_DELAY / 2)
+	ack("c", "2")
+	h.Send(&Event{ID: "3"})
+	h.Send(&Event{ID: "4"})
+	time.Sleep(CLIENT_DELAY / 2)
+	ack("b", "4")
+	v := map[string]string{"b": "4", "c": "2"}
+	if c := h.Cursors(""); !reflect.DeepEqual(c, v) {
+		t.Fatalf("%#v != %#v", c, v)
+	}
+}
@@ -0,0 +1,836 @@
+package sse
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// BrokerConfig provides a means of passing configuration to NewBroker.
+type BrokerConfig struct {
+
+	// NumEventsToKeep indicates the number of events that should be kept for
+	// clients reconnecting. If zero and either MaxEventAge or MaxEventBytes is
+	// set, the number of events is not limited. It is ignored if EventStore
+	// is provided.
+	NumEventsToKeep int
+
+	// MaxEventAge, if nonzero, indicates how long events should be kept for
+	// clients reconnecting. It is ignored if EventStore is provided.
+	MaxEventAge time.Duration
+
+	// MaxEventBytes, if nonzero, limits the total encoded size of the events
+	// kept for clients reconnecting. It is ignored if EventStore is provided.
+	MaxEventBytes int
+
+	// DisableReplay prevents events from being stored and causes the
+	// Last-Event-ID of reconnecting clients to be ignored.
+	DisableReplay bool
+
+	// EventStore, if provided, is used for storing events that are replayed
+	// to clients reconnecting. By default, a MemoryEventStore is used.
+	EventStore EventStore
+
+	// StreamEventStoreFn, if provided, creates the EventStore for each stream
+	// with a non-empty key. By default, a MemoryEventStore with the limits
+	// specified above is used.
+	StreamEventStoreFn func(string) EventStore
+
+	// NumShards, if greater than one, partitions the clients of each stream
+	// into the specified number of shards and delivers events to the shards
+	// in parallel. Events are delivered to the shards after the Broker's lock
+	// is released, with each shard receiving events in the order in which
+	// they were sent, so concurrent sends only contend while events are
+	// stored. Callbacks invoked during delivery, such as the match function
+	// passed to SendFunc, may therefore run concurrently and must be safe for
+	// concurrent use.
+	NumShards int
+
+	// IDGenerator, if provided, is used to assign IDs to events sent without
+	// one.
+	IDGenerator func() string
+
+	// StreamIDGeneratorFn, if provided, creates an ID generator for each
+	// stream that is used in place of IDGenerator, giving each stream its own
+	// ID namespace.
+	StreamIDGeneratorFn func(string) func() string
+
+	// EnableSequence assigns each event a number from a single sequence that
+	// increases by one with every event sent, stored in the event's Sequence
+	// field. Clients receive events in sequence order.
+	EnableSequence bool
+
+	// SuppressDuplicates causes an event to be skipped if it is identical to
+	// the previous event sent to the same stream and topic. Events are
+	// compared before an ID is generated for them. Events sent to specific
+	// clients, including those with an Audience, are never suppressed.
+	SuppressDuplicates bool
+
+	// DuplicateKeyFn, if provided, is used by SuppressDuplicates to compare
+	// events by the key it returns instead of their byte representation.
+	DuplicateKeyFn func(*Event) string
+
+	// SubscriberBufferSize indicates how many events are buffered for each
+	// subscriber created by Subscribe before it is disconnected. The default
+	// value is 64.
+	SubscriberBufferSize int
+
+	// LastValueKeyFn, if provided, enables a cache of the most recent event
+	// for each key it returns (for example, the event's type). The cached
+	// events are sent to every client that connects. Events for which it
+	// returns an empty string are not cached.
+	LastValueKeyFn func(*Event) string
+}
+
+// Broker distributes events to subscribed clients and stores them for
+// replay. It is independent of HTTP, allowing a single Broker to feed
+// multiple Handlers (such as authenticated and public endpoints with
+// different filters).
+type Broker struct {
+	mutex        sync.Mutex
+	cfg          *BrokerConfig
+	retention    MemoryEventStoreConfig
+	eventStore   EventStore
+	streamStores map[string]EventStore
+	conns        connSet
+	streamConns  map[string]shards
+	keyConns     map[any]connSet
+	topicConns   map[topicKey]connSet
+	ipConns      map[string]int
+	numSubs      int
+	lastEventIDs map[string]string
+	idGenerators map[string]func() string
+	lastValues   map[string]map[string]*lastValue
+	lastKeys     map[topicKey]string
+	lastValueSeq uint64
+	lastConnID   uint64
+	lastSequence uint64
+}
+
+// lastValue is an entry in the last-value cache; seq preserves the order in
+// which the events were sent.
+type lastValue struct {
+	seq uint64
+	e   *Event
+}
+
+// NewBroker creates a new Broker instance.
+func NewBroker(cfg *BrokerConfig) *Broker {
+	if cfg == nil {
+		cfg = &BrokerConfig{}
+	}
+	b := &Broker{
+		cfg:          cfg,
+		streamStores: make(map[string]EventStore),
+		conns:        make(connSet),
+		streamConns:  make(map[string]shards),
+		keyConns:     make(map[any]connSet),
+		topicConns:   make(map[topicKey]connSet),
+		ipConns:      make(map[string]int),
+		lastEventIDs: make(map[string]string),
+		idGenerators: make(map[string]func() string),
+		lastValues:   make(map[string]map[string]*lastValue),
+		lastKeys:     make(map[topicKey]string),
+		retention: MemoryEventStoreConfig{
+			NumEventsToKeep: cfg.NumEventsToKeep,
+			MaxAge:          cfg.MaxEventAge,
+			MaxBytes:        cfg.MaxEventBytes,
+		},
+	}
+	b.eventStore = cfg.EventStore
+	if b.eventStore == nil && !cfg.DisableReplay {
+		b.eventStore = b.newMemoryEventStore()
+	}
+	return b
+}
+
+// newMemoryEventStore creates a store using the current retention limits. The
+// mutex must be held when calling this method once the Broker is in use.
+func (b *Broker) newMemoryEventStore() EventStore {
+	cfg := b.retention
+	return NewMemoryEventStoreFromConfig(&cfg)
+}
+
+// storeFor returns the EventStore for the stream, creating it if necessary.
+// The mutex must be held when calling this method.
+func (b *Broker) storeFor(stream string) EventStore {
+	if stream == "" {
+		return b.eventStore
+	}
+	s, ok := b.streamStores[stream]
+	if !ok {
+		if b.cfg.StreamEventStoreFn != nil {
+			s = b.cfg.StreamEventStoreFn(stream)
+		} else {
+			s = b.newMemoryEventStore()
+		}
+		b.streamStores[stream] = s
+	}
+	return s
+}
+
+// SetRetention changes the limits on the events kept for clients reconnecting
+// while the Broker is running. The parameters have the same meaning as the
+// fields of BrokerConfig and apply to the stores created by the Broker; a
+// provided EventStore or the stores created by StreamEventStoreFn are not
+// affected.
+func (b *Broker) SetRetention(numEventsToKeep int, maxEventAge time.Duration, maxEventBytes int) {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	b.retention.NumEventsToKeep = numEventsToKeep
+	b.retention.MaxAge = maxEventAge
+	b.retention.MaxBytes = maxEventBytes
+	stores := []EventStore{}
+	if b.cfg.EventStore == nil {
+		stores = append(stores, b.eventStore)
+	}
+	if b.cfg.StreamEventStoreFn == nil {
+		for _, s := range b.streamStores {
+			stores = append(stores, s)
+		}
+	}
+	for _, s := range stores {
+		if m, ok := s.(*MemoryEventStore); ok {
+			m.SetLimits(numEventsToKeep, maxEventAge, maxEventBytes)
+		}
+	}
+}
+
+// idGeneratorFor returns the ID generator for the stream, creating it if
+// necessary, or nil if IDs are not generated. The mutex must be held when
+// calling this method.
+func (b *Broker) idGeneratorFor(stream string) func() string {
+	if b.cfg.StreamIDGeneratorFn == nil {
+		return b.cfg.IDGenerator
+	}
+	g, ok := b.idGenerators[stream]
+	if !ok {
+		g = b.cfg.StreamIDGeneratorFn(stream)
+		b.idGenerators[stream] = g
+	}
+	return g
+}
+
+// nextConnID allocates an ID for a new connection.
+func (b *Broker) nextConnID() uint64 {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	b.lastConnID++
+	return b.lastConnID
+}
+
+// addConnection registers the connection and adds it to the indexes. The
+// mutex must be held when calling this method.
+func (b *Broker) addConnection(conn *connection) {
+	b.conns[conn] = struct{}{}
+	if conn.subscriber {
+		b.numSubs++
+	} else {
+		b.ipConns[conn.remoteIP]++
+	}
+	streamConns, ok := b.streamConns[conn.stream]
+	if !ok {
+		streamConns = newShards(b.cfg.NumShards)
+		b.streamConns[conn.stream] = streamConns
+	}
+	streamConns.shardFor(conn).add(conn)
+	if conn.key != nil {
+		addToIndex(b.keyConns, conn.key, conn)
+	}
+	for t := range conn.topics {
+		addToIndex(b.topicConns, topicKey{conn.stream, t}, conn)
+	}
+}
+
+// closeConnection closes the connection's buffer and removes it from the
+// map and indexes. The mutex must be held when calling this method.
+func (b *Broker) closeConnection(conn *connection, reason DisconnectReason) {
+	if _, ok := b.conns[conn]; ok {
+		conn.reason = reason
+	}
+	conn.buffer.close()
+	b.removeConnection(conn)
+}
+
+// dropConnection removes the connection from the map and indexes if it is
+// still present, recording the reason. The mutex must be held when calling
+// this method.
+func (b *Broker) dropConnection(conn *connection, reason DisconnectReason) {
+	if _, ok := b.conns[conn]; ok {
+		conn.reason = reason
+		b.removeConnection(conn)
+	}
+}
+
+// removeConnection removes the connection from the map and indexes and closes
+// its buffer, since events being delivered may still reach it otherwise. The
+// mutex must be held when calling this method.
+func (b *Broker) removeConnection(conn *connection) {
+	if _, ok := b.conns[conn]; !ok {
+		return
+	}
+	conn.buffer.close()
+	delete(b.conns, conn)
+	if conn.subscriber {
+		b.numSubs--
+	} else if b.ipConns[conn.remoteIP]--; b.ipConns[conn.remoteIP] <= 0 {
+		delete(b.ipConns, conn.remoteIP)
+	}
+	streamConns := b.streamConns[conn.stream]
+	streamConns.shardFor(conn).remove(conn)
+	if streamConns.len() == 0 {
+		delete(b.streamConns, conn.stream)
+	}
+	if conn.key != nil {
+		removeFromIndex(b.keyConns, conn.key, conn)
+	}
+	for t := range conn.topics {
+		removeFromIndex(b.topicConns, topicKey{conn.stream, t}, conn)
+	}
+}
+
+// delivery is an event waiting for its turn to be delivered to connections
+// in a shard.
+type delivery struct {
+	shard  *shard
+	ticket uint64
+	conns  []*connection
+}
+
+// deliveriesFor reserves a place in the delivery order of each shard with
+// connections that may want the event, using the topic index if the event
+// has a topic. The mutex must be held when calling this method.
+func (b *Broker) deliveriesFor(e *Event) []*delivery {
+	if e.Topic != "" {
+		return b.deliveriesTo(b.topicConns[topicKey{e.stream, e.Topic}])
+	}
+	deliveries := []*delivery{}
+	for _, s := range b.streamConns[e.stream] {
+		if len(s.conns) == 0 {
+			continue
+		}
+		deliveries = append(deliveries, &delivery{
+			shard:  s,
+			ticket: s.ticket(),
+			conns:  s.conns,
+		})
+	}
+	return deliveries
+}
+
+// deliveriesTo is like deliveriesFor but for the provided connections. The
+// mutex must be held when calling this method.
+func (b *Broker) deliveriesTo(conns connSet) []*delivery {
+	var (
+		deliveries = []*delivery{}
+		shardMap   = make(map[*shard]*delivery)
+	)
+	for conn := range conns {
+		s := b.streamConns[conn.stream].shardFor(conn)
+		d, ok := shardMap[s]
+		if !ok {
+			d = &delivery{
+				shard:  s,
+				ticket: s.ticket(),
+			}
+			shardMap[s] = d
+			deliveries = append(deliveries, d)
+		}
+		d.conns = append(d.conns, conn)
+	}
+	return deliveries
+}
+
+// replay returns the stored events in the stream after the event with the
+// provided ID. The second return value is false if the event is not found.
+// Nothing is returned if replay is disabled.
+func (b *Broker) replay(stream, lastEventID string) ([]*Event, bool) {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	if b.cfg.DisableReplay {
+		return nil, true
+	}
+	events, err := b.storeFor(stream).Since(lastEventID)
+	if err == ErrEventNotFound {
+		return nil, false
+	}
+	if err != nil {
+		return nil, true
+	}
+	return events, true
+}
+
+// isDuplicate determines if the event should be suppressed because it is
+// identical to the previous one in its stream and topic, recording it for
+// the next comparison if not. Only events sent to all clients are compared;
+// events with an Audience are never suppressed. The mutex must be held when
+// calling this method.
+func (b *Broker) isDuplicate(e *Event) bool {
+	if !b.cfg.SuppressDuplicates || e.ephemeral ||
+		e.target != nil || e.match != nil || len(e.Audience) != 0 {
+		return false
+	}
+	var key string
+	if b.cfg.DuplicateKeyFn != nil {
+		key = b.cfg.DuplicateKeyFn(e)
+	} else {
+		key = string(e.Bytes())
+	}
+	k := topicKey{e.stream, e.Topic}
+	if lastKey, ok := b.lastKeys[k]; ok && lastKey == key {
+		return true
+	}
+	b.lastKeys[k] = key
+	return false
+}
+
+// cacheLastValue adds the event to the last-value cache if it is enabled. The
+// mutex must be held when calling this method.
+func (b *Broker) cacheLastValue(e *Event) {
+	if b.cfg.LastValueKeyFn == nil {
+		return
+	}
+	key := b.cfg.LastValueKeyFn(e)
+	if key == "" {
+		return
+	}
+	m, ok := b.lastValues[e.stream]
+	if !ok {
+		m = make(map[string]*lastValue)
+		b.lastValues[e.stream] = m
+	}
+	b.lastValueSeq++
+	m[key] = &lastValue{seq: b.lastValueSeq, e: e}
+}
+
+// lastValuesFor returns the cached events for the stream in the order they
+// were sent.
+func (b *Broker) lastValuesFor(stream string) []*Event {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	values := make([]*lastValue, 0, len(b.lastValues[stream]))
+	for _, v := range b.lastValues[stream] {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool {
+		return values[i].seq < values[j].seq
+	})
+	events := make([]*Event, len(values))
+	for i, v := range values {
+		events[i] = v.e
+	}
+	return events
+}
+
+// SendStats provides information about the delivery of an event.
+type SendStats struct {
+
+	// Delivered is the number of clients the event was queued for.
+	Delivered int
+
+	// Buffered is the number of clients (included in Delivered) that already
+	// had events waiting in their buffer, indicating that they are lagging.
+	Buffered int
+
+	// Disconnected is the number of clients that were disconnected because
+	// their buffer was full (or MaxBufferedBytes was exceeded).
+	Disconnected int
+
+	// Shed is the number of clients the event was discarded for because
+	// MaxBufferedBytes was exceeded.
+	Shed int
+
+	// StoreErr is the error returned when adding the event to the
+	// EventStore, if any.
+	StoreErr error
+
+	// Suppressed indicates that the event was not sent because it was
+	// identical to the previous one (see SuppressDuplicates).
+	Suppressed bool
+}
+
+// Send sends the provided event to all connected clients. Any clients that
+// block are handled according to SlowClientPolicy.
+func (b *Broker) Send(e *Event) SendStats {
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		p = b.queue(e, b.deliveriesFor)
+	}()
+	return b.dispatch(p)
+}
+
+// SendBatch sends the provided events to all connected clients as a unit:
+// each client receives them contiguously and in order, without events from
+// other sends in between, and they are stored together. The returned slice
+// contains the statistics for each event.
+func (b *Broker) SendBatch(events []*Event) []SendStats {
+	pending := make([]*pendingSend, len(events))
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		for i, e := range events {
+			pending[i] = b.queue(e, nil)
+		}
+		for _, p := range pending {
+			if p.e != nil {
+				p.deliveries = b.deliveriesFor(p.e)
+			}
+		}
+	}()
+	stats := make([]SendStats, len(events))
+	for i, p := range pending {
+		stats[i] = b.dispatch(p)
+	}
+	return stats
+}
+
+// SendContext sends the provided event to all connected clients and waits
+// until it has been written to each of them (or they have disconnected) or
+// the context is done.
+func (b *Broker) SendContext(ctx context.Context, e *Event) error {
+	eCopy := *e
+	eCopy.written = &sync.WaitGroup{}
+	b.Send(&eCopy)
+	doneChan := make(chan struct{})
+	go func() {
+		eCopy.written.Wait()
+		close(doneChan)
+	}()
+	select {
+	case <-doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SendAt sends the provided event at the specified time. The returned
+// function cancels the send and reports whether it did so before the event
+// was sent.
+func (b *Broker) SendAt(t time.Time, e *Event) func() bool {
+	return b.SendAfter(time.Until(t), e)
+}
+
+// SendAfter sends the provided event once the specified duration has
+// elapsed. The returned function cancels the send and reports whether it did
+// so before the event was sent.
+func (b *Broker) SendAfter(d time.Duration, e *Event) func() bool {
+	eCopy := *e
+	t := time.AfterFunc(d, func() {
+		b.Send(&eCopy)
+	})
+	return t.Stop
+}
+
+// SendTo sends the provided event only to clients whose value returned by
+// ConnectedFn is equal to key, which must be comparable.
+func (b *Broker) SendTo(key any, e *Event) SendStats {
+	eCopy := *e
+	eCopy.target = key
+	eCopy.excludeTarget = false
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		p = b.queue(&eCopy, func(*Event) []*delivery {
+			return b.deliveriesTo(b.keyConns[key])
+		})
+	}()
+	return b.dispatch(p)
+}
+
+// SendToAllExcept sends the provided event to all clients except those whose
+// value returned by ConnectedFn is equal to key, which must be comparable.
+func (b *Broker) SendToAllExcept(key any, e *Event) SendStats {
+	eCopy := *e
+	eCopy.target = key
+	eCopy.excludeTarget = true
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		p = b.queue(&eCopy, b.deliveriesFor)
+	}()
+	return b.dispatch(p)
+}
+
+// pendingSend is an event that has been stored and has a place in the
+// delivery order of the shards but has not been delivered yet.
+type pendingSend struct {
+	e          *Event
+	deliveries []*delivery
+	stats      SendStats
+}
+
+// queue prepares the event for delivery to the connections returned by
+// targets and adds it to the store. The returned value must be passed to
+// dispatch once the mutex is released. Targets is called last, since it
+// reserves a place in the delivery order of the shards that must not be left
+// unused if user-provided code panics; a nil targets leaves the deliveries to
+// the caller. The mutex must be held when calling this method.
+func (b *Broker) queue(e *Event, targets func(*Event) []*delivery) *pendingSend {
+	if b.isDuplicate(e) {
+		return &pendingSend{stats: SendStats{Suppressed: true}}
+	}
+	eCopy := *e
+	if eCopy.ID == "" {
+		if g := b.idGeneratorFor(eCopy.stream); g != nil {
+			eCopy.ID = g()
+		}
+	}
+	if b.cfg.EnableSequence {
+		b.lastSequence++
+		eCopy.Sequence = b.lastSequence
+	}
+
+	// Encode the event once so that the result can be shared by all of the
+	// connections (and the store) instead of each encoding it separately
+	eCopy.encoded = eCopy.Bytes()
+	e = &eCopy
+
+	p := &pendingSend{e: e}
+	if !e.ephemeral {
+		if e.ID != "" {
+			b.lastEventIDs[e.stream] = e.ID
+		}
+		b.cacheLastValue(e)
+		if !b.cfg.DisableReplay {
+			s := b.storeFor(e.stream)
+			if p.stats.StoreErr = s.Append(e); p.stats.StoreErr == nil {
+				s.Trim()
+			}
+		}
+	}
+	if targets != nil {
+		p.deliveries = targets(e)
+	}
+	return p
+}
+
+// dispatch delivers a queued event to each of the shards, in parallel if
+// there is more than one. The mutex must not be held when calling this
+// method, since delivery waits for earlier events to be delivered and clients
+// that need to be disconnected are closed afterwards.
+func (b *Broker) dispatch(p *pendingSend) SendStats {
+	stats := p.stats
+	if p.e == nil {
+		return stats
+	}
+	results := make([]shardResult, len(p.deliveries))
+	if len(p.deliveries) == 1 {
+		results[0] = b.deliver(p.e, p.deliveries[0])
+	} else {
+		wg := sync.WaitGroup{}
+		for i, d := range p.deliveries {
+			wg.Add(1)
+			go func(i int, d *delivery) {
+				defer wg.Done()
+				results[i] = b.deliver(p.e, d)
+			}(i, d)
+		}
+		wg.Wait()
+	}
+	slowConns := []*connection{}
+	for _, r := range results {
+		stats.Delivered += r.stats.Delivered
+		stats.Buffered += r.stats.Buffered
+		stats.Disconnected += r.stats.Disconnected
+		stats.Shed += r.stats.Shed
+		slowConns = append(slowConns, r.slowConns...)
+	}
+	if len(slowConns) != 0 {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		for _, conn := range slowConns {
+			b.closeConnection(conn, DisconnectSlowClient)
+		}
+	}
+	return stats
+}
+
+type shardResult struct {
+	stats     SendStats
+	slowConns []*connection
+}
+
+// deliver enqueues the event for the connections in the delivery that want
+// it once it is the delivery's turn.
+func (b *Broker) deliver(e *Event, d *delivery) shardResult {
+	d.shard.wait(d.ticket)
+	defer d.shard.done()
+	r := shardResult{}
+	for _, conn := range d.conns {
+		if !conn.wants(e) {
+			continue
+		}
+		if !conn.buffer.budget.allows(e) {
+			if conn.cfg.MemoryBudgetPolicy == MemoryBudgetDisconnect {
+				r.slowConns = append(r.slowConns, conn)
+				r.stats.Disconnected++
+				continue
+			}
+			conn.numShed.Add(1)
+			signal(conn.buffer.readyChan)
+			r.stats.Shed++
+			continue
+		}
+		buffered := conn.buffer.len() != 0
+		if e.written != nil {
+			e.written.Add(1)
+		}
+		if !conn.enqueue(e) {
+			e.markWritten()
+
+			// The connection may have been removed since the event was
+			// queued, in which case it is not a slow client
+			if conn.buffer.isClosed() {
+				continue
+			}
+			r.slowConns = append(r.slowConns, conn)
+			r.stats.Disconnected++
+			continue
+		}
+		r.stats.Delivered++
+		if buffered {
+			r.stats.Buffered++
+		}
+		conn.checkLag()
+	}
+	return r
+}
+
+// SendFunc sends the provided event to all clients for which match returns
+// true. The parameter passed to match is equal to the value returned by
+// ConnectedFn. The function is also used when the event is replayed and must
+// be safe for concurrent use.
+func (b *Broker) SendFunc(e *Event, match func(any) bool) SendStats {
+	eCopy := *e
+	eCopy.match = match
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		p = b.queue(&eCopy, b.deliveriesFor)
+	}()
+	return b.dispatch(p)
+}
+
+// Redirect instructs clients to reconnect to the provided URL, which may be
+// relative to the URL they are connected to. If match is provided, only
+// clients for which it returns true are redirected. Clients must enable
+// FollowRedirectEvents in ClientConfig for this to take effect.
+func (b *Broker) Redirect(url string, match func(any) bool) SendStats {
+	e := &Event{
+		Type:      RedirectEventType,
+		Data:      url,
+		match:     match,
+		ephemeral: true,
+	}
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		p = b.queue(e, b.deliveriesFor)
+	}()
+	return b.dispatch(p)
+}
+
+// SendToStream sends the provided event to all clients attached to the
+// stream with the provided key (see StreamKeyFn).
+func (b *Broker) SendToStream(key string, e *Event) SendStats {
+	eCopy := *e
+	eCopy.stream = key
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		p = b.queue(&eCopy, b.deliveriesFor)
+	}()
+	return b.dispatch(p)
+}
+
+// CloseStream disconnects all clients attached to the stream with the
+// provided key and discards its stored events, cached last values, and ID
+// generator.
+func (b *Broker) CloseStream(key string) {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	for _, shard := range b.streamConns[key] {
+		for _, conn := range shard.conns {
+			b.closeConnection(conn, DisconnectServerClosed)
+		}
+	}
+	delete(b.streamStores, key)
+	delete(b.lastEventIDs, key)
+	delete(b.idGenerators, key)
+	delete(b.lastValues, key)
+	for k := range b.lastKeys {
+		if k.stream == key {
+			delete(b.lastKeys, k)
+		}
+	}
+}
+
+// SendToTopic sends the provided event to all clients subscribed to the
+// topic. The event's Topic field is ignored and left unchanged.
+func (b *Broker) SendToTopic(topic string, e *Event) SendStats {
+	eCopy := *e
+	eCopy.Topic = topic
+	return b.Send(&eCopy)
+}
+
+// Connections returns information about all active client connections.
+func (b *Broker) Connections() []*ConnectionInfo {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	infos := []*ConnectionInfo{}
+	for conn := range b.conns {
+		infos = append(infos, conn.info())
+	}
+	return infos
+}
+
+// SendToConnection sends the provided event only to the connection with the
+// provided ID. The event is not stored since the ID is not retained when the
+// client reconnects. The return value indicates whether the connection was
+// found.
+func (b *Broker) SendToConnection(id uint64, e *Event) bool {
+	var p *pendingSend
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		for conn := range b.conns {
+			if conn.id == id {
+				eCopy := *e
+				eCopy.stream = conn.stream
+				eCopy.ephemeral = true
+				p = b.queue(&eCopy, func(*Event) []*delivery {
+					return b.deliveriesTo(connSet{conn: struct{}{}})
+				})
+				return
+			}
+		}
+	}()
+	if p == nil {
+		return false
+	}
+	b.dispatch(p)
+	return true
+}
+
+// Disconnect forcibly closes the connection with the provided ID. The return
+// value indicates whether the connection was found.
+func (b *Broker) Disconnect(id uint64) bool {
+	defer b.mutex.Unlock()
+	b.mutex.Lock()
+	for conn := range b.conns {
+		if conn.id == id {
+			b.closeConnection(conn, DisconnectKicked)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,315 @@
+package sse
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestBroker(t *testing.T) {
+	b := NewBroker(&BrokerConfig{NumEventsToKeep: 10})
+	var (
+		public = &testHandlerServerAndClient{}
+		admin  = &testHandlerServerAndClient{}
+	)
+	public.CreateHandlerAndServer(&HandlerConfig{
+		Broker:            b,
+		ChannelBufferSize: 4,
+		FilterFn: func(_ any, e *Event) bool {
+			return e.Type != "private"
+		},
+	})
+	defer public.CloseHandlerAndServer()
+	admin.CreateHandlerAndServer(&HandlerConfig{
+		Broker:            b,
+		ChannelBufferSize: 4,
+	})
+	defer admin.CloseHandlerAndServer()
+	for _, h := range []*testHandlerServerAndClient{public, admin} {
+		if err := h.CreateClient(); err != nil {
+			t.Fatal(err)
+		}
+		defer h.CloseClient()
+	}
+	time.Sleep(CLIENT_DELAY)
+	if s := b.Send(&Event{Type: "private"}); s.Delivered != 2 {
+		t.Fatalf("%#v != %#v", s.Delivered, 2)
+	}
+	b.Send(&Event{Type: "public"})
+	for _, v := range []struct {
+		Name   string
+		Client *testHandlerServerAndClient
+		Types  []string
+	}{
+		{
+			Name:   "public",
+			Client: public,
+			Types:  []string{"public"},
+		},
+		{
+			Name:   "admin",
+			Client: admin,
+			Types:  []string{"private", "public"},
+		},
+	} {
+		for _, typ := range v.Types {
+			select {
+			case e := <-v.Client.Client.Events:
+				if e.Type != typ {
+					t.Fatalf("%s: %#v != %#v", v.Name, e.Type, typ)
+				}
+			case <-time.After(CLIENT_DELAY):
+				t.Fatalf("%s: timeout waiting for event", v.Name)
+			}
+		}
+	}
+
+	// Closing one of the handlers must leave the other's clients connected
+	public.Handler.Close()
+	if n := len(b.Connections()); n != 1 {
+		t.Fatalf("%#v != %#v", n, 1)
+	}
+}
+
+func TestBrokerSendAfter(t *testing.T) {
+	b := NewBroker(&BrokerConfig{NumEventsToKeep: 10})
+	b.SendAfter(CLIENT_DELAY/2, &Event{ID: "1"})
+	cancel := b.SendAt(time.Now().Add(CLIENT_DELAY/2), &Event{ID: "2"})
+	if !cancel() {
+		t.Fatal("send was not canceled")
+	}
+	b.SendAt(time.Now().Add(-time.Second), &Event{ID: "3"})
+	time.Sleep(CLIENT_DELAY)
+	events, _ := b.replay("", "")
+	if len(events) != 2 {
+		t.Fatalf("%#v != %#v", len(events), 2)
+	}
+	for _, e := range events {
+		if e.ID == "2" {
+			t.Fatal("canceled event was sent")
+		}
+	}
+}
+
+func TestBrokerSequence(t *testing.T) {
+	b := NewBroker(&BrokerConfig{
+		NumEventsToKeep:      100,
+		EnableSequence:       true,
+		SubscriberBufferSize: 100,
+	})
+	eventChan, cancel := b.Subscribe(nil)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				b.Send(&Event{})
+			}
+		}()
+	}
+	wg.Wait()
+	for i := uint64(1); i <= 100; i++ {
+		select {
+		case e := <-eventChan:
+			if e.Sequence != i {
+				t.Fatalf("%#v != %#v", e.Sequence, i)
+			}
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+}
+
+func TestBrokerSendBatch(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep:   100,
+		ChannelBufferSize: 100,
+	})
+	defer h.Close()
+	eventChan, cancel := h.Subscribe(nil)
+	defer cancel()
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			h.SendBatch([]*Event{
+				{Type: "begin"},
+				{Type: "part"},
+				{Type: "end"},
+			})
+		}()
+	}
+	wg.Wait()
+	for i := 0; i < 30; i++ {
+		select {
+		case e := <-eventChan:
+			if typ := []string{"begin", "part", "end"}[i%3]; e.Type != typ {
+				t.Fatalf("%#v != %#v", e.Type, typ)
+			}
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+}
+
+func TestBrokerSuppressDuplicates(t *testing.T) {
+	for _, v := range []struct {
+		Name       string
+		KeyFn      func(*Event) string
+		Suppressed []bool
+	}{
+		{
+			Name:       "byte-identical",
+			Suppressed: []bool{false, true, false, false, false, false, false},
+		},
+		{
+			Name: "by key",
+			KeyFn: func(e *Event) string {
+				return e.Type
+			},
+			Suppressed: []bool{false, true, true, false, false, false, false},
+		},
+	} {
+		b := NewBroker(&BrokerConfig{
+			SuppressDuplicates: true,
+			DuplicateKeyFn:     v.KeyFn,
+			IDGenerator:        NewCounterIDGenerator(0),
+		})
+		for i, e := range []*Event{
+			{Type: "a", Data: "1"},
+			{Type: "a", Data: "1"},
+			{Type: "a", Data: "2"},
+			{Type: "b", Data: "2"},
+			{Type: "b", Data: "2", Topic: "t"},
+			{Data: "3", Audience: []string{"alice"}},
+			{Data: "3", Audience: []string{"bob"}},
+		} {
+			if s := b.Send(e); s.Suppressed != v.Suppressed[i] {
+				t.Fatalf("%s: %d: %#v != %#v", v.Name, i, s.Suppressed, v.Suppressed[i])
+			}
+		}
+	}
+}
+
+func TestBrokerShardedDelivery(t *testing.T) {
+	b := NewBroker(&BrokerConfig{
+		NumShards:      4,
+		EnableSequence: true,
+	})
+	buffers := []*ringBuffer{}
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		for i := 0; i < 8; i++ {
+			r := newRingBuffer(1000)
+			buffers = append(buffers, r)
+			b.addConnection(&connection{
+				id:     uint64(i),
+				buffer: r,
+				cfg:    &HandlerConfig{},
+			})
+		}
+	}()
+	wg := sync.WaitGroup{}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				b.Send(&Event{})
+			}
+		}()
+	}
+	wg.Wait()
+	for i, r := range buffers {
+		var last uint64
+		for n := 0; n < 200; n++ {
+			e, _ := r.pop()
+			if e == nil {
+				t.Fatalf("%d: missing event %d", i, n)
+			}
+			if e.Sequence <= last {
+				t.Fatalf("%d: %d received after %d", i, e.Sequence, last)
+			}
+			last = e.Sequence
+		}
+	}
+}
+
+func TestBrokerDeliveryWithoutLock(t *testing.T) {
+	b := NewBroker(&BrokerConfig{})
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		b.addConnection(&connection{
+			buffer: newRingBuffer(1),
+			cfg:    &HandlerConfig{},
+		})
+	}()
+	var (
+		matchChan   = make(chan struct{})
+		releaseChan = make(chan struct{})
+	)
+	go b.SendFunc(&Event{}, func(any) bool {
+		close(matchChan)
+		<-releaseChan
+		return true
+	})
+	defer close(releaseChan)
+	<-matchChan
+	doneChan := make(chan struct{})
+	go func() {
+		b.Connections()
+		close(doneChan)
+	}()
+	select {
+	case <-doneChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("lock held during delivery")
+	}
+}
+
+func TestBrokerSendPanic(t *testing.T) {
+	n := 0
+	b := NewBroker(&BrokerConfig{
+		IDGenerator: func() string {
+			if n++; n == 2 {
+				panic("failed")
+			}
+			return strconv.Itoa(n)
+		},
+	})
+	r := newRingBuffer(10)
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		b.addConnection(&connection{
+			buffer: r,
+			cfg:    &HandlerConfig{ChannelBufferSize: 10},
+		})
+	}()
+	func() {
+		defer func() {
+			recover()
+		}()
+		b.SendBatch([]*Event{{Data: "1"}, {Data: "2"}})
+	}()
+
+	// Neither the mutex nor the delivery order may be left held
+	doneChan := make(chan SendStats)
+	go func() {
+		doneChan <- b.Send(&Event{Data: "3"})
+	}()
+	select {
+	case s := <-doneChan:
+		if s.Delivered != 1 {
+			t.Fatalf("%#v != %#v", s.Delivered, 1)
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("send blocked after a panic")
+	}
+}
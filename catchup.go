@@ -0,0 +1,125 @@
+package sse
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+const (
+	// defaultCatchUpLimit and maxCatchUpLimit control the number of events
+	// in each page returned by CatchUpHandler.
+	defaultCatchUpLimit = 100
+	maxCatchUpLimit     = 1000
+)
+
+// CatchUpEvent is the JSON representation of an event returned by
+// CatchUpHandler.
+type CatchUpEvent struct {
+	ID   string `json:"id,omitempty"`
+	Type string `json:"type,omitempty"`
+	Data string `json:"data"`
+}
+
+// CatchUpPage is the JSON response body of CatchUpHandler.
+type CatchUpPage struct {
+	Events []*CatchUpEvent `json:"events"`
+
+	// LastEventID is the ID of the last event in the page, which should be
+	// passed as the "since" parameter to request the next page or used as
+	// the Last-Event-ID when opening the event stream.
+	LastEventID string `json:"lastEventId,omitempty"`
+
+	// More indicates that there are more events after this page.
+	More bool `json:"more"`
+}
+
+// CatchUpHandler returns an http.Handler that serves the stored events as
+// JSON so that clients that were offline for longer than a reconnect can
+// catch up over plain HTTP before opening the event stream. The "since" query
+// parameter is the ID of the last event received and "limit" is the maximum
+// number of events in the response (100 by default). Clients are authorized
+// and identified with the same callbacks as ServeHTTP and only receive the
+// events they would be sent on the event stream. If "since" is not in the
+// store, UnknownEventIDPolicy is applied, with UnknownEventIDResync resulting
+// in a 410 response.
+func (h *Handler) CatchUpHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			http.Error(
+				w,
+				http.StatusText(http.StatusMethodNotAllowed),
+				http.StatusMethodNotAllowed,
+			)
+			return
+		}
+		if !h.trustedOrigin(r) {
+			http.Error(
+				w,
+				http.StatusText(http.StatusForbidden),
+				http.StatusForbidden,
+			)
+			return
+		}
+		limit := defaultCatchUpLimit
+		if s := r.URL.Query().Get("limit"); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 1 {
+				http.Error(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			if n > maxCatchUpLimit {
+				n = maxCatchUpLimit
+			}
+			limit = n
+		}
+		r, v, ok := h.accept(w, r)
+		if !ok {
+			return
+		}
+		binding := h.resumeBinding(r)
+		since, ok := h.verifyID(binding, r.URL.Query().Get("since"))
+		if !ok {
+			http.Error(w, errInvalidResumeToken.Error(), http.StatusBadRequest)
+			return
+		}
+		conn := h.newConnection(r, 0, v)
+		events, ok := h.replay(conn.stream, since)
+		if !ok {
+			switch h.cfg.UnknownEventIDPolicy {
+			case UnknownEventIDReplayAll:
+				events, _ = h.replay(conn.stream, "")
+			case UnknownEventIDResync:
+				http.Error(
+					w,
+					http.StatusText(http.StatusGone),
+					http.StatusGone,
+				)
+				return
+			}
+		}
+		page := &CatchUpPage{Events: []*CatchUpEvent{}}
+		for _, e := range h.conflate(conn, events) {
+			if !conn.wants(e) {
+				continue
+			}
+			if e = h.prepare(conn, e); e == nil {
+				continue
+			}
+			if len(page.Events) == limit {
+				page.More = true
+				break
+			}
+			id := h.signID(binding, e.ID)
+			page.Events = append(page.Events, &CatchUpEvent{
+				ID:   id,
+				Type: e.Type,
+				Data: e.Data,
+			})
+			page.LastEventID = id
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	})
+}
@@ -0,0 +1,104 @@
+package sse
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestCatchUpHandler(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep:      10,
+		UnknownEventIDPolicy: UnknownEventIDResync,
+		FilterFn: func(_ any, e *Event) bool {
+			return e.Type != "private"
+		},
+	})
+	defer h.Close()
+	h.Send(&Event{ID: "1", Data: "a"})
+	h.Send(&Event{ID: "2", Type: "private"})
+	h.Send(&Event{ID: "3", Type: "b", Data: "b"})
+	h.Send(&Event{ID: "4", Data: "c"})
+	for _, v := range []struct {
+		Name       string
+		Method     string
+		URL        string
+		StatusCode int
+		Page       *CatchUpPage
+	}{
+		{
+			Name:       "wrong method",
+			Method:     http.MethodPost,
+			URL:        "/",
+			StatusCode: http.StatusMethodNotAllowed,
+		},
+		{
+			Name:       "invalid limit",
+			Method:     http.MethodGet,
+			URL:        "/?limit=x",
+			StatusCode: http.StatusBadRequest,
+		},
+		{
+			Name:       "unknown ID",
+			Method:     http.MethodGet,
+			URL:        "/?since=0",
+			StatusCode: http.StatusGone,
+		},
+		{
+			Name:       "first page",
+			Method:     http.MethodGet,
+			URL:        "/?limit=2",
+			StatusCode: http.StatusOK,
+			Page: &CatchUpPage{
+				Events: []*CatchUpEvent{
+					{ID: "1", Data: "a"},
+					{ID: "3", Type: "b", Data: "b"},
+				},
+				LastEventID: "3",
+				More:        true,
+			},
+		},
+		{
+			Name:       "last page",
+			Method:     http.MethodGet,
+			URL:        "/?since=3&limit=2",
+			StatusCode: http.StatusOK,
+			Page: &CatchUpPage{
+				Events: []*CatchUpEvent{
+					{ID: "4", Data: "c"},
+				},
+				LastEventID: "4",
+			},
+		},
+		{
+			Name:       "empty page",
+			Method:     http.MethodGet,
+			URL:        "/?since=4",
+			StatusCode: http.StatusOK,
+			Page: &CatchUpPage{
+				Events: []*CatchUpEvent{},
+			},
+		},
+	} {
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(v.Method, v.URL, nil)
+		)
+		h.CatchUpHandler().ServeHTTP(w, r)
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+		if v.Page == nil {
+			continue
+		}
+		page := &CatchUpPage{}
+		if err := json.NewDecoder(w.Body).Decode(page); err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if !reflect.DeepEqual(page, v.Page) {
+			t.Fatalf("%s: %#v != %#v", v.Name, page, v.Page)
+		}
+	}
+}
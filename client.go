@@ -3,13 +3,296 @@ package sse
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync/atomic"
 	"time"
 )
 
-const defaultReconnectionTime = time.Second * 3
+const (
+	defaultReconnectionTime      = time.Second * 3
+	defaultAuthExpiryMargin      = time.Second * 30
+	defaultFallbackThreshold     = 3
+	defaultFallbackRetryInterval = time.Minute * 5
+)
+
+var (
+	errConnectionClosed = errors.New("connection was closed by the server")
+	errRequestRequired  = errors.New("a request, list of URLs, or dial function must be provided")
+	errLifetimeExceeded = errors.New("maximum stream lifetime exceeded")
+	errAuthExpiring     = errors.New("credentials are about to expire")
+	errPollComplete     = errors.New("long-polling request completed")
+	errRedirected       = errors.New("server requested a different URL")
+	errTooManyRedirects = errors.New("stopped after 10 redirects")
+)
+
+// RedirectPolicy determines how the client responds to redirects.
+type RedirectPolicy int
+
+const (
+
+	// RedirectFollow follows redirects for each connection, re-applying the
+	// SSE request headers (including Last-Event-ID) to every request.
+	RedirectFollow RedirectPolicy = iota
+
+	// RedirectFollowAndPin follows redirects like RedirectFollow and then uses
+	// the final URL for all subsequent reconnects.
+	RedirectFollowAndPin
+
+	// RedirectStop does not follow redirects. Instead, the client shuts down
+	// and Err() returns a *RedirectError describing the redirect.
+	RedirectStop
+)
+
+// RedirectError indicates that the server attempted to redirect the client
+// while RedirectStop was in effect.
+type RedirectError struct {
+	StatusCode int
+	Location   string
+}
+
+func (e *RedirectError) Error() string {
+	return fmt.Sprintf("redirected (%d) to %s", e.StatusCode, e.Location)
+}
+
+// PanicError is returned by Err() when the client was shut down because
+// OnEvent panicked. Value holds the value passed to panic().
+type PanicError struct {
+	Value any
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic in OnEvent: %v", e.Value)
+}
+
+// stopError wraps an error that should cause the client to shut down rather
+// than reconnect.
+type stopError struct {
+	err error
+}
+
+func (e *stopError) Error() string {
+	return e.err.Error()
+}
+
+// transport identifies the means by which the client receives events.
+type transport int
+
+const (
+	transportSSE transport = iota
+	transportWebSocket
+	transportLongPoll
+)
+
+// DialFunc opens a stream of SSE-formatted data, resuming after lastEventID
+// where possible. Returning a nil io.ReadCloser and nil error indicates that the
+// stream has finished and the client should not reconnect.
+type DialFunc func(ctx context.Context, lastEventID string) (io.ReadCloser, error)
+
+// ClientConfig provides a means of passing configuration to
+// NewClientFromConfig.
+type ClientConfig struct {
+
+	// Request is used as a template for each connection to the server. It may
+	// be left nil if URLs is provided, in which case a GET request is used.
+	Request *http.Request
+
+	// DialFunc, if provided, is used to open the stream in place of sending
+	// Request, allowing the client to consume streams from sources other than
+	// HTTP. Request, URLs, and the options that apply to HTTP responses are
+	// ignored. Errors returned by DialFunc count as failed connections.
+	DialFunc DialFunc
+
+	// URLs, if provided, lists endpoints that serve the same event stream.
+	// The URL of Request is replaced with the current endpoint for each
+	// connection and the client moves on to the next endpoint after
+	// FailoverThreshold consecutive failed connection attempts. The last event
+	// ID is preserved when switching endpoints.
+	URLs []string
+
+	// FailoverThreshold indicates how many consecutive connection attempts
+	// must fail before the client moves to the next entry in URLs. The
+	// default value is 1.
+	FailoverThreshold int
+
+	// WebSocketURL, if provided, is a WebSocket endpoint (ws:// or wss://)
+	// whose messages each contain one or more events in SSE format. The
+	// client switches to it after FallbackThreshold consecutive failed
+	// connection attempts, sending the Last-Event-ID header in the handshake.
+	// Events continue to be delivered in the same way. Note that the
+	// handshake requires Client to use HTTP/1.1.
+	WebSocketURL string
+
+	// WebSocketProtocol is the subprotocol requested in the WebSocket
+	// handshake. The handshake fails unless the server accepts it. The
+	// default value is "sse".
+	WebSocketProtocol string
+
+	// MaxWebSocketFrameSize limits the size of the payload of each data frame
+	// received over the WebSocket connection. Larger frames cause the
+	// connection to be closed. The default value is 1 MiB.
+	MaxWebSocketFrameSize int
 
-var errConnectionClosed = errors.New("connection was closed by the server")
+	// LongPollURL, if provided, is an endpoint that responds with any pending
+	// events in SSE format and then ends the response. The client switches to
+	// polling this endpoint after FallbackThreshold consecutive failed
+	// connection attempts (including any made with WebSocketURL), sending the
+	// Last-Event-ID header with each request. Events continue to be delivered
+	// in the same way.
+	LongPollURL string
+
+	// LongPollInterval is the delay between long-polling requests. If zero,
+	// the reconnection time (which the server may change) is used.
+	LongPollInterval time.Duration
+
+	// FallbackThreshold indicates how many consecutive connection attempts
+	// must fail before the client switches to the next fallback transport.
+	// The default value is 3.
+	FallbackThreshold int
+
+	// FallbackRetryInterval indicates how long the client uses fallback
+	// transports before trying to connect using SSE again. A single failed
+	// attempt returns the client to the fallback. The default value is five
+	// minutes.
+	FallbackRetryInterval time.Duration
+
+	// Client is used for sending the requests. If set to nil,
+	// http.DefaultClient will be used.
+	Client *http.Client
+
+	// Jar, if provided, is used to store cookies set by the server and send
+	// them with each request, in place of any jar set on Client. Cookies set
+	// by an earlier authentication handshake can be placed in the jar before
+	// the client is created.
+	Jar http.CookieJar
+
+	// WithCredentials, like the EventSource option of the same name, causes
+	// cookies to be stored and sent. If neither Jar nor the Jar of Client is
+	// set, an in-memory jar is created so that session cookies persist across
+	// reconnects.
+	WithCredentials bool
+
+	// LastEventID, if provided, is used as the last event ID for the first
+	// connection, allowing a stream to be resumed from a previous session.
+	LastEventID string
+
+	// LastEventIDFn, if provided, is invoked with the last event ID and the
+	// URL being requested each time the Last-Event-ID header is set. The
+	// returned value is sent in place of the stored ID, with an empty value
+	// omitting the header. This allows IDs to be translated when resuming
+	// against a server that uses a different ID scheme.
+	LastEventIDFn func(lastEventID string, u *url.URL) string
+
+	// CatchUpFn, if provided, is invoked with the last event ID before each
+	// connection attempt. The events it returns are delivered before the
+	// stream is opened, advancing the last event ID. This is useful for
+	// fetching missed events over plain HTTP when the server's replay window
+	// is short. An error causes the connection attempt to fail.
+	CatchUpFn func(ctx context.Context, lastEventID string) ([]*Event, error)
+
+	// MaxStreamLifetime, if nonzero, limits how long each connection to the
+	// server may remain open. Once it elapses, the connection is closed and a
+	// new one is established immediately, resuming from the last event ID.
+	MaxStreamLifetime time.Duration
+
+	// CloseOnMaxStreamLifetime causes the client to shut down instead of
+	// reconnecting when MaxStreamLifetime elapses.
+	CloseOnMaxStreamLifetime bool
+
+	// FollowRedirectEvents causes events with the type RedirectEventType to
+	// be handled by the client instead of delivered to the application. The
+	// client immediately reconnects to the URL in the event's data (resolved
+	// relative to the current URL), which replaces the URLs in use.
+	FollowRedirectEvents bool
+
+	// NextAuthExpiry, if provided, is invoked before each connection and
+	// returns the time at which the credentials used for the connection
+	// expire. The connection is closed and immediately re-established
+	// AuthExpiryMargin before that time, allowing fresh credentials to be
+	// used without the server dropping the stream. The zero value or a time
+	// that has already passed is ignored.
+	NextAuthExpiry func() time.Time
+
+	// AuthExpiryMargin indicates how long before credentials expire the
+	// client should reconnect. The default value is 30 seconds.
+	AuthExpiryMargin time.Duration
+
+	// RedirectPolicy determines how redirects are handled. The default value
+	// is RedirectFollow. Any CheckRedirect function set on Client is still
+	// invoked when redirects are followed.
+	RedirectPolicy RedirectPolicy
+
+	// EventTypes, if provided, restricts the events delivered to those with a
+	// type in the list. Other events are dropped and counted (see
+	// DroppedEvents()). Note that events without a type have the type
+	// "message".
+	EventTypes []string
+
+	// TerminalStatusCodes lists HTTP status codes that indicate the stream has
+	// finished, causing the client to shut down instead of reconnecting. HTTP
+	// 204 is always treated this way.
+	TerminalStatusCodes []int
+
+	// TerminalEventTypes lists event types that indicate the stream has
+	// finished. The event is delivered and the client then shuts down.
+	TerminalEventTypes []string
+
+	// ReaderConfig, if provided, configures the Reader used to parse the
+	// stream, such as the maximum size of lines and events. A
+	// *SizeLimitError is treated like any other error reading the stream.
+	ReaderConfig *ReaderConfig
+
+	// Spool, if provided, durably stores each event before it is delivered.
+	// When the client starts, events in the spool that were not acknowledged
+	// with Ack() are delivered first and the stream resumes from the last
+	// event ID in the spool.
+	Spool Spool
+
+	// OnEvent, if provided, is invoked for each event received instead of
+	// sending it on the Events channel, which is then only used to indicate
+	// that the client has shut down. If OnEvent returns an error or panics,
+	// the client shuts down and the error (or a *PanicError) is returned by
+	// Err(). OnEvent is never invoked concurrently.
+	OnEvent func(*Event) error
+
+	// TimestampFn, if provided, returns the time at which the server sent an
+	// event and false if the event does not include one. These timestamps are
+	// used to compute the statistics returned by Latency(). If not provided,
+	// the timestamps in heartbeat events are used.
+	TimestampFn func(*Event) (time.Time, bool)
+
+	// LatencyWindow indicates how many of the most recent latency samples are
+	// used for computing statistics. The default value is 100.
+	LatencyWindow int
+
+	// Clock, if provided, is used for all timing performed by the client,
+	// including waiting to reconnect. If not provided, the system clock is
+	// used.
+	Clock Clock
+
+	// OnError, if provided, is invoked with the error that interrupted or
+	// prevented a connection each time the client is about to reconnect.
+	OnError func(error)
+
+	// ReconnectLimiter, if provided, is used to limit connection attempts
+	// and may be shared with other clients to cap the number of attempts made
+	// at the same time across the entire process.
+	ReconnectLimiter *ReconnectLimiter
+
+	// ReconnectJitter, if nonzero, adds a random delay of up to the specified
+	// duration to the reconnection time. This prevents large numbers of
+	// clients from reconnecting at the same instant.
+	ReconnectJitter time.Duration
+
+	// OnResponse, if provided, is invoked with the response each time a
+	// connection to the server is established and before any events are
+	// read from it. The response body must not be read or closed.
+	OnResponse func(*http.Response)
+}
 
 // Client connects to a server providing SSE. The client will continue to
 // maintain the connection, resuming from the last event ID when disconnected.
@@ -18,34 +301,145 @@ type Client struct {
 	// Events provides a stream of events from the server.
 	Events <-chan *Event
 
-	req              *http.Request
+	cfg              *ClientConfig
 	client           *http.Client
+	eventTypes       map[string]struct{}
+	latency          *latencyTracker
+	numDropped       uint64
+	urls             []*url.URL
+	urlIndex         int
+	webSocketURL     *url.URL
+	longPollURL      *url.URL
+	transports       []transport
+	transport        transport
+	fallbackAt       time.Time
+	failures         int
 	lastEventID      string
 	reconnectionTime time.Duration
+	reader           *Reader
 	cancel           context.CancelFunc
 	closedChan       <-chan any
+	err              error
+}
+
+func (c *Client) setHeaders(req *http.Request) {
+	req.Header.Set("Accept", "text/event-stream")
+	req.Header.Set("Cache-Control", "no-cache")
+	req.Header.Set("Connection", "keep-alive")
+	lastEventID := c.lastEventID
+	if c.cfg.LastEventIDFn != nil {
+		lastEventID = c.cfg.LastEventIDFn(lastEventID, req.URL)
+	}
+	if len(lastEventID) != 0 {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	} else {
+		req.Header.Del("Last-Event-ID")
+	}
+}
+
+func (c *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if c.cfg.RedirectPolicy == RedirectStop {
+		return http.ErrUseLastResponse
+	}
+	c.setHeaders(req)
+	if c.cfg.Client.CheckRedirect != nil {
+		return c.cfg.Client.CheckRedirect(req, via)
+	}
+	if len(via) >= 10 {
+		return errTooManyRedirects
+	}
+	return nil
 }
 
 func (c *Client) connectionLoop(
 	ctx context.Context,
 	eventChan chan<- *Event,
 ) error {
-	req := c.req.Clone(ctx)
-	req.Header.Set("Accept", "text/event-stream")
-	req.Header.Set("Cache-Control", "no-cache")
-	req.Header.Set("Connection", "keep-alive")
-	if len(c.lastEventID) != 0 {
-		req.Header.Set("Last-Event-ID", c.lastEventID)
+	var (
+		connCtx     = ctx
+		deadline    time.Time
+		deadlineErr = errLifetimeExceeded
+	)
+	now := c.cfg.Clock.Now()
+	if c.cfg.MaxStreamLifetime != 0 {
+		deadline = now.Add(c.cfg.MaxStreamLifetime)
+	}
+	if c.cfg.NextAuthExpiry != nil {
+		t := c.cfg.NextAuthExpiry().Add(-c.cfg.AuthExpiryMargin)
+		if t.After(now) && (deadline.IsZero() || t.Before(deadline)) {
+			deadline = t
+			deadlineErr = errAuthExpiring
+		}
+	}
+	if !deadline.IsZero() {
+		var cancel context.CancelFunc
+		connCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-c.cfg.Clock.After(deadline.Sub(now)):
+				cancel()
+			case <-connCtx.Done():
+			}
+		}()
+	}
+	if err := c.connect(connCtx, eventChan); err != nil {
+		if _, ok := err.(*stopError); ok {
+			return err
+		}
+		if ctx.Err() == nil && connCtx.Err() != nil {
+			return deadlineErr
+		}
+		return err
+	}
+	return nil
+}
+
+func (c *Client) connect(
+	ctx context.Context,
+	eventChan chan<- *Event,
+) error {
+	if c.cfg.CatchUpFn != nil {
+		events, err := c.cfg.CatchUpFn(ctx, c.lastEventID)
+		if err != nil {
+			c.connectionFailed()
+			return err
+		}
+		for _, e := range events {
+			if e.ID != "" {
+				c.lastEventID = e.ID
+			}
+			if err := c.handleEvent(ctx, eventChan, e); err != nil {
+				return err
+			}
+		}
+	}
+	if c.cfg.ReconnectLimiter != nil {
+		if err := c.cfg.ReconnectLimiter.acquire(ctx, c.cfg.Clock); err != nil {
+			return err
+		}
+	}
+	body, err := c.dial(ctx)
+	if c.cfg.ReconnectLimiter != nil {
+		c.cfg.ReconnectLimiter.Release()
 	}
-	r, err := c.client.Do(req)
 	if err != nil {
+		if _, ok := err.(*stopError); !ok {
+			c.connectionFailed()
+		}
 		return err
 	}
-	defer r.Body.Close()
-	if r.StatusCode == http.StatusNoContent {
+	if body == nil {
 		return nil
 	}
-	reader := NewReader(r.Body)
+	defer body.Close()
+	c.failures = 0
+	if c.reader == nil {
+		c.reader = NewReaderFromConfig(body, c.cfg.ReaderConfig)
+	} else {
+		c.reader.Reset(body)
+	}
+	reader := c.reader
 	reader.LastEventID = c.lastEventID
 	defer func() {
 		c.lastEventID = reader.LastEventID
@@ -60,13 +454,213 @@ func (c *Client) connectionLoop(
 			return err
 		}
 		if e == nil {
+			if c.transport == transportLongPoll {
+				return errPollComplete
+			}
 			return errConnectionClosed
 		}
-		select {
-		case eventChan <- e:
-		case <-ctx.Done():
-			return ctx.Err()
+		if c.cfg.FollowRedirectEvents &&
+			e.Type == RedirectEventType &&
+			len(c.urls) != 0 {
+			if err := c.redirect(e.Data); err != nil {
+				return err
+			}
+			return errRedirected
+		}
+		if err := c.handleEvent(ctx, eventChan, e); err != nil {
+			return err
+		}
+		for _, t := range c.cfg.TerminalEventTypes {
+			if e.Type == t {
+				return nil
+			}
+		}
+	}
+}
+
+// redirect replaces the URLs in use with the provided one.
+func (c *Client) redirect(rawURL string) error {
+	u, err := c.urls[c.urlIndex].Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	c.urls = []*url.URL{u}
+	c.urlIndex = 0
+	return nil
+}
+
+// dial opens the stream using the current transport.
+func (c *Client) dial(ctx context.Context) (io.ReadCloser, error) {
+	switch {
+	case c.cfg.DialFunc != nil:
+		return c.cfg.DialFunc(ctx, c.lastEventID)
+	case c.transport == transportWebSocket:
+		return c.dialWebSocket(ctx)
+	default:
+		return c.dialHTTP(ctx)
+	}
+}
+
+// dialHTTP sends the request for the event stream to the current URL and
+// returns the response body if the server accepted it.
+func (c *Client) dialHTTP(ctx context.Context) (io.ReadCloser, error) {
+	u := c.urls[c.urlIndex]
+	if c.transport == transportLongPoll {
+		u = c.longPollURL
+	}
+	req := c.cfg.Request.Clone(ctx)
+	if u != c.cfg.Request.URL {
+		uCopy := *u
+		req.URL = &uCopy
+		req.Host = ""
+	}
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	c.setHeaders(req)
+	r, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.OnResponse != nil {
+		c.cfg.OnResponse(r)
+	}
+	if r.StatusCode != http.StatusOK {
+		r.Body.Close()
+	}
+	switch r.StatusCode {
+	case http.StatusOK:
+	case http.StatusNoContent:
+		return nil, nil
+	case http.StatusMovedPermanently,
+		http.StatusFound,
+		http.StatusSeeOther,
+		http.StatusTemporaryRedirect,
+		http.StatusPermanentRedirect:
+		if c.cfg.RedirectPolicy == RedirectStop {
+			return nil, &stopError{
+				err: &RedirectError{
+					StatusCode: r.StatusCode,
+					Location:   r.Header.Get("Location"),
+				},
+			}
+		}
+		fallthrough
+	default:
+		for _, code := range c.cfg.TerminalStatusCodes {
+			if r.StatusCode == code {
+				return nil, nil
+			}
+		}
+		return nil, fmt.Errorf("unexpected status code %d", r.StatusCode)
+	}
+	if c.transport == transportSSE &&
+		c.cfg.RedirectPolicy == RedirectFollowAndPin &&
+		r.Request.URL.String() != req.URL.String() {
+		c.urls[c.urlIndex] = r.Request.URL
+	}
+	return r.Body, nil
+}
+
+// handleEvent drops the event if its type was not requested and otherwise
+// delivers it to the application.
+func (c *Client) handleEvent(
+	ctx context.Context,
+	eventChan chan<- *Event,
+	e *Event,
+) error {
+	if t, ok := c.cfg.TimestampFn(e); ok {
+		c.latency.add(c.cfg.Clock.Now().Sub(t))
+	}
+	if c.eventTypes != nil {
+		if _, ok := c.eventTypes[e.Type]; !ok {
+			atomic.AddUint64(&c.numDropped, 1)
+			return nil
+		}
+	}
+	if c.cfg.Spool != nil {
+		if err := c.cfg.Spool.Append(e); err != nil {
+			return &stopError{err: err}
+		}
+	}
+	return c.deliver(ctx, eventChan, e)
+}
+
+// resumeSpool delivers any events that were not acknowledged and restores the
+// last event ID from the spool.
+func (c *Client) resumeSpool(
+	ctx context.Context,
+	eventChan chan<- *Event,
+) error {
+	lastEventID, err := c.cfg.Spool.LastEventID()
+	if err != nil {
+		return err
+	}
+	if lastEventID != "" {
+		c.lastEventID = lastEventID
+	}
+	events, err := c.cfg.Spool.Pending()
+	if err != nil {
+		return err
+	}
+	for _, e := range events {
+		if err := c.deliver(ctx, eventChan, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) invokeOnEvent(e *Event) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v}
 		}
+	}()
+	return c.cfg.OnEvent(e)
+}
+
+// deliver passes the event to the application, either through OnEvent or the
+// event channel.
+func (c *Client) deliver(
+	ctx context.Context,
+	eventChan chan<- *Event,
+	e *Event,
+) error {
+	if c.cfg.OnEvent != nil {
+		if err := c.invokeOnEvent(e); err != nil {
+			return &stopError{err: err}
+		}
+		return nil
+	}
+	select {
+	case eventChan <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connectionFailed records a failed connection attempt and switches to the
+// next URL once the failover threshold is reached.
+func (c *Client) connectionFailed() {
+	c.failures++
+	for i, t := range c.transports[:len(c.transports)-1] {
+		if t == c.transport && c.failures >= c.cfg.FallbackThreshold {
+			if i == 0 {
+				c.fallbackAt = c.cfg.Clock.Now()
+			}
+			c.transport = c.transports[i+1]
+			c.failures = 0
+			return
+		}
+	}
+	if c.transport == transportSSE && len(c.urls) > 1 && c.failures%c.cfg.FailoverThreshold == 0 {
+		c.urlIndex = (c.urlIndex + 1) % len(c.urls)
 	}
 }
 
@@ -77,40 +671,195 @@ func (c *Client) lifecycleLoop(
 ) {
 	defer close(closedChan)
 	defer close(eventChan)
+	if c.cfg.Spool != nil {
+		if err := c.resumeSpool(ctx, eventChan); err != nil {
+			if sErr, ok := err.(*stopError); ok {
+				err = sErr.err
+			}
+			if ctx.Err() == nil {
+				c.err = err
+			}
+			return
+		}
+	}
 	for {
-		if err := c.connectionLoop(ctx, eventChan); err == nil {
+		if c.transport != c.transports[0] &&
+			c.cfg.Clock.Now().Sub(c.fallbackAt) >= c.cfg.FallbackRetryInterval {
+			c.transport = c.transports[0]
+			c.failures = c.cfg.FallbackThreshold - 1
+		}
+		t := c.transport
+		err := c.connectionLoop(ctx, eventChan)
+		if err == nil {
+			return
+		}
+		var sErr *stopError
+		if errors.As(err, &sErr) {
+			c.err = sErr.err
+			return
+		}
+		if err == errLifetimeExceeded {
+			if c.cfg.CloseOnMaxStreamLifetime {
+				return
+			}
+			continue
+		}
+		if err == errPollComplete {
+			delay := c.cfg.LongPollInterval
+			if delay == 0 {
+				delay = c.reconnectionTime
+			}
+			select {
+			case <-c.cfg.Clock.After(delay):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+		if err == errAuthExpiring || err == errRedirected {
+			continue
+		}
+		if ctx.Err() != nil {
 			return
 		}
+		if c.cfg.OnError != nil {
+			c.cfg.OnError(err)
+		}
+		if c.transport != t {
+			continue
+		}
+		delay := c.reconnectionTime
+		if c.cfg.ReconnectJitter > 0 {
+			delay += time.Duration(rand.Int63n(int64(c.cfg.ReconnectJitter)))
+		}
 		select {
-		case <-time.After(c.reconnectionTime):
+		case <-c.cfg.Clock.After(delay):
 		case <-ctx.Done():
 			return
 		}
 	}
 }
 
-// NewClient creates a new SSE client from the provided parameters. If client
-// is set to nil, http.DefaultClient will be used. The client will begin
-// connecting to the server and continue sending events until an HTTP 204 is
-// received or explicitly terminated with Close().
-func NewClient(req *http.Request, client *http.Client) *Client {
-	if client == nil {
-		client = http.DefaultClient
+func newClient(cfg *ClientConfig) (*Client, error) {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	if cfg.FailoverThreshold <= 0 {
+		cfg.FailoverThreshold = 1
+	}
+	if cfg.FallbackThreshold <= 0 {
+		cfg.FallbackThreshold = defaultFallbackThreshold
+	}
+	if cfg.FallbackRetryInterval <= 0 {
+		cfg.FallbackRetryInterval = defaultFallbackRetryInterval
+	}
+	if cfg.AuthExpiryMargin == 0 {
+		cfg.AuthExpiryMargin = defaultAuthExpiryMargin
+	}
+	if cfg.Clock == nil {
+		cfg.Clock = realClock{}
+	}
+	if cfg.TimestampFn == nil {
+		cfg.TimestampFn = heartbeatTimestamp
+	}
+	if cfg.LatencyWindow <= 0 {
+		cfg.LatencyWindow = defaultLatencyWindow
+	}
+	if cfg.WebSocketProtocol == "" {
+		cfg.WebSocketProtocol = defaultWebSocketProtocol
+	}
+	if cfg.MaxWebSocketFrameSize <= 0 {
+		cfg.MaxWebSocketFrameSize = defaultMaxWebSocketFrameSize
+	}
+	urls := []*url.URL{}
+	for _, rawURL := range cfg.URLs {
+		u, err := url.Parse(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		urls = append(urls, u)
+	}
+	if cfg.Request == nil && len(urls) != 0 {
+		r, err := http.NewRequest(http.MethodGet, cfg.URLs[0], nil)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Request = r
+	}
+	if len(urls) == 0 && cfg.Request != nil {
+		urls = []*url.URL{cfg.Request.URL}
+	}
+	var (
+		transports   = []transport{transportSSE}
+		webSocketURL *url.URL
+		longPollURL  *url.URL
+	)
+	if cfg.WebSocketURL != "" {
+		u, err := parseWebSocketURL(cfg.WebSocketURL)
+		if err != nil {
+			return nil, err
+		}
+		webSocketURL = u
+		transports = append(transports, transportWebSocket)
+	}
+	if cfg.LongPollURL != "" {
+		u, err := url.Parse(cfg.LongPollURL)
+		if err != nil {
+			return nil, err
+		}
+		longPollURL = u
+		transports = append(transports, transportLongPoll)
 	}
 	var (
 		ctx, cancel = context.WithCancel(context.Background())
 		eventChan   = make(chan *Event)
 		closedChan  = make(chan any)
+		httpClient  = *cfg.Client
 		c           = &Client{
 			Events:           eventChan,
-			req:              req,
-			client:           client,
+			cfg:              cfg,
+			client:           &httpClient,
+			lastEventID:      cfg.LastEventID,
+			urls:             urls,
+			webSocketURL:     webSocketURL,
+			longPollURL:      longPollURL,
+			transports:       transports,
+			latency:          newLatencyTracker(cfg.LatencyWindow),
 			reconnectionTime: defaultReconnectionTime,
 			cancel:           cancel,
 			closedChan:       closedChan,
 		}
 	)
+	httpClient.CheckRedirect = c.checkRedirect
+	if cfg.Jar != nil {
+		httpClient.Jar = cfg.Jar
+	}
+	if cfg.WithCredentials && httpClient.Jar == nil {
+
+		// cookiejar.New only returns an error for invalid options
+		httpClient.Jar, _ = cookiejar.New(nil)
+	}
+	if len(cfg.EventTypes) != 0 {
+		c.eventTypes = make(map[string]struct{})
+		for _, t := range cfg.EventTypes {
+			c.eventTypes[t] = struct{}{}
+		}
+	}
 	go c.lifecycleLoop(ctx, eventChan, closedChan)
+	return c, nil
+}
+
+// NewClient creates a new SSE client from the provided parameters. If client
+// is set to nil, http.DefaultClient will be used. The client will begin
+// connecting to the server and continue sending events until an HTTP 204 is
+// received or explicitly terminated with Close().
+func NewClient(req *http.Request, client *http.Client) *Client {
+
+	// No URLs need to be parsed, so this cannot fail
+	c, _ := newClient(&ClientConfig{
+		Request: req,
+		Client:  client,
+	})
 	return c
 }
 
@@ -124,6 +873,95 @@ func NewClientFromURL(url string) (*Client, error) {
 	return NewClient(r, nil), nil
 }
 
+// NewClientFromConfig creates a new SSE client using the provided
+// configuration. A copy of the configuration is made, so modifying it after
+// this function returns has no effect on the client.
+func NewClientFromConfig(cfg *ClientConfig) (*Client, error) {
+	if cfg == nil ||
+		(cfg.Request == nil && len(cfg.URLs) == 0 && cfg.DialFunc == nil) {
+		return nil, errRequestRequired
+	}
+	cfgCopy := *cfg
+	return newClient(&cfgCopy)
+}
+
+// ReadBatch waits for an event and then continues gathering events until max
+// events have been received or maxWait has elapsed since the first one. If
+// the context is canceled while gathering, the events received so far are
+// returned. Once the client has shut down and no events remain, io.EOF is
+// returned. ReadBatch cannot be used when OnEvent is set.
+func (c *Client) ReadBatch(
+	ctx context.Context,
+	max int,
+	maxWait time.Duration,
+) ([]*Event, error) {
+	var events []*Event
+	select {
+	case e, ok := <-c.Events:
+		if !ok {
+			return nil, io.EOF
+		}
+		events = append(events, e)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	timerChan := c.cfg.Clock.After(maxWait)
+	for len(events) < max {
+		select {
+		case e, ok := <-c.Events:
+			if !ok {
+				return events, nil
+			}
+			events = append(events, e)
+		case <-timerChan:
+			return events, nil
+		case <-ctx.Done():
+			return events, nil
+		}
+	}
+	return events, nil
+}
+
+// Ack acknowledges that the oldest unacknowledged event delivered by the
+// client has been processed and no longer needs to be retained in the spool.
+// Nothing happens if Spool was not provided.
+func (c *Client) Ack() error {
+	if c.cfg.Spool == nil {
+		return nil
+	}
+	return c.cfg.Spool.Ack()
+}
+
+// Jar returns the cookie jar used by the client, which is nil if cookies are
+// not being stored.
+func (c *Client) Jar() http.CookieJar {
+	return c.client.Jar
+}
+
+// Latency returns statistics for the delivery latency of recent events that
+// included a server timestamp.
+func (c *Client) Latency() LatencyStats {
+	return c.latency.stats()
+}
+
+// DroppedEvents returns the number of events that were dropped because their
+// type was not included in EventTypes.
+func (c *Client) DroppedEvents() uint64 {
+	return atomic.LoadUint64(&c.numDropped)
+}
+
+// Err returns the error that caused the client to shut down, if any. It
+// returns nil while the client is running and when it was shut down by an HTTP
+// 204 or a call to Close().
+func (c *Client) Err() error {
+	select {
+	case <-c.closedChan:
+		return c.err
+	default:
+		return nil
+	}
+}
+
 // Close disconnects and shuts down the client.
 func (c *Client) Close() {
 	c.cancel()
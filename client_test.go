@@ -1,10 +1,16 @@
 package sse
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -158,3 +164,756 @@ func TestClient(t *testing.T) {
 		}()
 	}
 }
+
+func TestClientOnResponse(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Stream-ID", "1")
+			w.Write([]byte("data\n\n"))
+		},
+	))
+	defer s.Close()
+	r, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respChan := make(chan *http.Response, 1)
+	c, err := NewClientFromConfig(&ClientConfig{
+		Request: r,
+		OnResponse: func(r *http.Response) {
+			select {
+			case respChan <- r:
+			default:
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := receiveAtLeastNEvents(1, c, CLIENT_DELAY); err != nil {
+		t.Fatal(err)
+	}
+	resp := <-respChan
+	if v := resp.Header.Get("X-Stream-ID"); v != "1" {
+		t.Fatalf("%#v != %#v", v, "1")
+	}
+}
+
+func TestNewClientFromConfig(t *testing.T) {
+	if _, err := NewClientFromConfig(nil); err != errRequestRequired {
+		t.Fatalf("%#v != %#v", err, errRequestRequired)
+	}
+}
+
+func TestClientFailover(t *testing.T) {
+	var (
+		i          = 0
+		lastIDChan = make(chan string, 1)
+	)
+	s1 := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if i > 0 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte("id:1\nretry:10\ndata\n\n"))
+			i += 1
+		},
+	))
+	defer s1.Close()
+	s2 := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case lastIDChan <- r.Header.Get("Last-Event-ID"):
+			default:
+			}
+			w.WriteHeader(http.StatusNoContent)
+		},
+	))
+	defer s2.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs: []string{s1.URL, s2.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := receiveAtLeastNEvents(1, c, CLIENT_DELAY); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case v := <-lastIDChan:
+		if v != "1" {
+			t.Fatalf("%#v != %#v", v, "1")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not fail over to the second URL")
+	}
+}
+
+func TestClientMaxStreamLifetime(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	defer s.Close()
+	for _, v := range []struct {
+		Name  string
+		Close bool
+	}{
+		{
+			Name:  "reconnect",
+			Close: false,
+		},
+		{
+			Name:  "close",
+			Close: true,
+		},
+	} {
+		func() {
+			c, err := NewClientFromConfig(&ClientConfig{
+				URLs:                     []string{s.URL},
+				MaxStreamLifetime:        CLIENT_DELAY / 4,
+				CloseOnMaxStreamLifetime: v.Close,
+			})
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			defer c.Close()
+			err = receiveAtLeastNEvents(2, c, CLIENT_DELAY)
+			if v.Close && err == nil {
+				t.Fatalf("%s: expected client to shut down", v.Name)
+			}
+			if !v.Close && err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+		}()
+	}
+}
+
+func TestClientRedirect(t *testing.T) {
+	for _, v := range []struct {
+		Name           string
+		Policy         RedirectPolicy
+		NumEvents      int
+		NumOldRequests int
+		Err            bool
+	}{
+		{
+			Name:           "follow",
+			Policy:         RedirectFollow,
+			NumEvents:      2,
+			NumOldRequests: 2,
+		},
+		{
+			Name:           "follow and pin",
+			Policy:         RedirectFollowAndPin,
+			NumEvents:      2,
+			NumOldRequests: 1,
+		},
+		{
+			Name:           "stop",
+			Policy:         RedirectStop,
+			NumEvents:      0,
+			NumOldRequests: 1,
+			Err:            true,
+		},
+	} {
+		func() {
+			var (
+				numOldRequests = 0
+				serverErr      error
+			)
+			mux := http.NewServeMux()
+			mux.HandleFunc("/old", func(w http.ResponseWriter, r *http.Request) {
+				numOldRequests += 1
+				http.Redirect(w, r, "/new", http.StatusTemporaryRedirect)
+			})
+			mux.HandleFunc("/new", func(w http.ResponseWriter, r *http.Request) {
+				if v := r.Header.Get("Accept"); v != "text/event-stream" {
+					serverErr = fmt.Errorf("unexpected Accept header %#v", v)
+				}
+				w.Write([]byte("id:1\nretry:10\ndata\n\n"))
+			})
+			s := httptest.NewServer(mux)
+			defer s.Close()
+			c, err := NewClientFromConfig(&ClientConfig{
+				URLs:           []string{s.URL + "/old"},
+				RedirectPolicy: v.Policy,
+			})
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			if err := receiveAtLeastNEvents(v.NumEvents, c, CLIENT_DELAY); err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			if v.Err {
+				for range c.Events {
+				}
+			}
+			c.Close()
+			if serverErr != nil {
+				t.Fatalf("%s: %s", v.Name, serverErr)
+			}
+			if numOldRequests != v.NumOldRequests {
+				t.Fatalf("%s: %#v != %#v", v.Name, numOldRequests, v.NumOldRequests)
+			}
+			var rErr *RedirectError
+			if errors.As(c.Err(), &rErr) != v.Err {
+				t.Fatalf("%s: unexpected error %#v", v.Name, c.Err())
+			}
+		}()
+	}
+}
+
+func TestClientOnEvent(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data:1\n\ndata:2\n\n"))
+		},
+	))
+	defer s.Close()
+	var errStop = errors.New("stop")
+	for _, v := range []struct {
+		Name      string
+		OnEvent   func(*Event) error
+		NumEvents int
+		Err       func(error) bool
+	}{
+		{
+			Name: "error",
+			OnEvent: func(e *Event) error {
+				if e.Data == "2" {
+					return errStop
+				}
+				return nil
+			},
+			NumEvents: 2,
+			Err: func(err error) bool {
+				return err == errStop
+			},
+		},
+		{
+			Name: "panic",
+			OnEvent: func(e *Event) error {
+				panic("test")
+			},
+			NumEvents: 1,
+			Err: func(err error) bool {
+				var pErr *PanicError
+				return errors.As(err, &pErr) && pErr.Value == "test"
+			},
+		},
+	} {
+		func() {
+			numEvents := 0
+			c, err := NewClientFromConfig(&ClientConfig{
+				URLs: []string{s.URL},
+				OnEvent: func(e *Event) error {
+					numEvents += 1
+					return v.OnEvent(e)
+				},
+			})
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			defer c.Close()
+			select {
+			case _, ok := <-c.Events:
+				if ok {
+					t.Fatalf("%s: unexpected event received", v.Name)
+				}
+			case <-time.After(CLIENT_DELAY):
+				t.Fatalf("%s: client did not shut down", v.Name)
+			}
+			if numEvents != v.NumEvents {
+				t.Fatalf("%s: %#v != %#v", v.Name, numEvents, v.NumEvents)
+			}
+			if !v.Err(c.Err()) {
+				t.Fatalf("%s: unexpected error %#v", v.Name, c.Err())
+			}
+		}()
+	}
+}
+
+func TestClientEventTypes(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("event:a\ndata\n\nevent:b\ndata\n\nevent:a\ndata\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:       []string{s.URL},
+		EventTypes: []string{"a"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-c.Events:
+			if e.Type != "a" {
+				t.Fatalf("%#v != %#v", e.Type, "a")
+			}
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+	if v := c.DroppedEvents(); v != 1 {
+		t.Fatalf("%#v != %#v", v, 1)
+	}
+}
+
+func TestClientReadBatch(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("data:1\n\ndata:2\n\ndata:3\n\n"))
+		},
+	))
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs: []string{s.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, v := range []struct {
+		Name      string
+		Max       int
+		NumEvents int
+	}{
+		{
+			Name:      "reach max",
+			Max:       2,
+			NumEvents: 2,
+		},
+		{
+			Name:      "reach timeout",
+			Max:       2,
+			NumEvents: 1,
+		},
+	} {
+		events, err := c.ReadBatch(context.Background(), v.Max, CLIENT_DELAY/4)
+		if err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if len(events) != v.NumEvents {
+			t.Fatalf("%s: %#v != %#v", v.Name, len(events), v.NumEvents)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY/4)
+	defer cancel()
+	if _, err := c.ReadBatch(ctx, 1, 0); err != context.DeadlineExceeded {
+		t.Fatalf("%#v != %#v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestClientCatchUp(t *testing.T) {
+	lastIDChan := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lastIDChan <- r.Header.Get("Last-Event-ID")
+			w.WriteHeader(http.StatusNoContent)
+		},
+	))
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:        []string{s.URL},
+		LastEventID: "1",
+		CatchUpFn: func(ctx context.Context, lastEventID string) ([]*Event, error) {
+			if lastEventID != "1" {
+				return nil, fmt.Errorf("%#v != %#v", lastEventID, "1")
+			}
+			return []*Event{{ID: "2"}, {ID: "3"}}, nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := receiveAtLeastNEvents(2, c, CLIENT_DELAY); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-lastIDChan; v != "3" {
+		t.Fatalf("%#v != %#v", v, "3")
+	}
+}
+
+func TestClientLastEventIDFn(t *testing.T) {
+	lastIDChan := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lastIDChan <- r.Header.Get("Last-Event-ID")
+			w.WriteHeader(http.StatusNoContent)
+		},
+	))
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:        []string{s.URL},
+		LastEventID: "1",
+		LastEventIDFn: func(lastEventID string, u *url.URL) string {
+			return "shard-" + lastEventID
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if v := <-lastIDChan; v != "shard-1" {
+		t.Fatalf("%#v != %#v", v, "shard-1")
+	}
+}
+
+func TestClientTerminalConditions(t *testing.T) {
+	for _, v := range []struct {
+		Name      string
+		Config    *ClientConfig
+		Body      string
+		Status    int
+		NumEvents int
+	}{
+		{
+			Name:   "status code",
+			Config: &ClientConfig{TerminalStatusCodes: []int{http.StatusGone}},
+			Status: http.StatusGone,
+		},
+		{
+			Name:      "event type",
+			Config:    &ClientConfig{TerminalEventTypes: []string{"complete"}},
+			Body:      "data\n\nevent:complete\ndata\n\ndata\n\n",
+			Status:    http.StatusOK,
+			NumEvents: 2,
+		},
+	} {
+		func() {
+			s := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					w.WriteHeader(v.Status)
+					w.Write([]byte(v.Body))
+				},
+			))
+			defer s.Close()
+			v.Config.URLs = []string{s.URL}
+			c, err := NewClientFromConfig(v.Config)
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			defer c.Close()
+			numEvents := 0
+			timeout := time.After(CLIENT_DELAY)
+			for {
+				select {
+				case _, ok := <-c.Events:
+					if ok {
+						numEvents += 1
+						continue
+					}
+				case <-timeout:
+					t.Fatalf("%s: client did not shut down", v.Name)
+				}
+				break
+			}
+			if numEvents != v.NumEvents {
+				t.Fatalf("%s: %#v != %#v", v.Name, numEvents, v.NumEvents)
+			}
+			if err := c.Err(); err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+		}()
+	}
+}
+
+func TestClientDialFunc(t *testing.T) {
+	var (
+		i           = 0
+		lastEventID string
+	)
+	c, err := NewClientFromConfig(&ClientConfig{
+		DialFunc: func(ctx context.Context, v string) (io.ReadCloser, error) {
+			defer func() { i += 1 }()
+			switch i {
+			case 0:
+				return io.NopCloser(strings.NewReader("id:1\nretry:10\ndata\n\n")), nil
+			case 1:
+				return nil, errors.New("dial failed")
+			default:
+				lastEventID = v
+				return nil, nil
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := receiveAtLeastNEvents(1, c, CLIENT_DELAY); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case _, ok := <-c.Events:
+		if ok {
+			t.Fatal("unexpected event received")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not shut down")
+	}
+	if lastEventID != "1" {
+		t.Fatalf("%#v != %#v", lastEventID, "1")
+	}
+}
+
+func TestClientNextAuthExpiry(t *testing.T) {
+	tokenChan := make(chan string, 2)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case tokenChan <- r.Header.Get("Authorization"):
+			default:
+			}
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	defer s.Close()
+	i := 0
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs: []string{s.URL},
+		NextAuthExpiry: func() time.Time {
+			return time.Now().Add(CLIENT_DELAY / 2)
+		},
+		AuthExpiryMargin: CLIENT_DELAY / 4,
+		Client: &http.Client{
+			Transport: roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				i += 1
+				r.Header.Set("Authorization", strconv.Itoa(i))
+				return http.DefaultTransport.RoundTrip(r)
+			}),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, v := range []string{"1", "2"} {
+		select {
+		case token := <-tokenChan:
+			if token != v {
+				t.Fatalf("%#v != %#v", token, v)
+			}
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("client did not reconnect")
+		}
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClientLongPollFallback(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Last-Event-ID") {
+		case "":
+			w.Write([]byte("id:1\ndata:1\n\n"))
+		case "1":
+			w.Write([]byte("id:2\ndata:2\n\n"))
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:              []string{s.URL + "/sse"},
+		LongPollURL:       s.URL + "/poll",
+		LongPollInterval:  time.Millisecond,
+		FallbackThreshold: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, v := range []string{"1", "2"} {
+		select {
+		case e := <-c.Events:
+			if e.Data != v {
+				t.Fatalf("%#v != %#v", e.Data, v)
+			}
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("timeout waiting for event")
+		}
+	}
+}
+
+func TestClientWithCredentials(t *testing.T) {
+	cookieChan := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			c, err := r.Cookie("session")
+			if err != nil {
+				http.SetCookie(w, &http.Cookie{Name: "session", Value: "1"})
+				w.Write([]byte("retry:10\n\n"))
+				return
+			}
+			cookieChan <- c.Value
+			w.WriteHeader(http.StatusNoContent)
+		},
+	))
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:            []string{s.URL},
+		WithCredentials: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if c.Jar() == nil {
+		t.Fatal("cookie jar was not created")
+	}
+	select {
+	case v := <-cookieChan:
+		if v != "1" {
+			t.Fatalf("%#v != %#v", v, "1")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("cookie was not sent on reconnect")
+	}
+}
+
+func TestClientFollowRedirectEvents(t *testing.T) {
+	var (
+		h1 = NewHandler(nil)
+		h2 = NewHandler(nil)
+		s1 = httptest.NewServer(h1)
+		s2 = httptest.NewServer(h2)
+	)
+	defer s2.Close()
+	defer s1.Close()
+	defer h2.Close()
+	defer h1.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:                 []string{s1.URL},
+		FollowRedirectEvents: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	time.Sleep(CLIENT_DELAY)
+	if s := h1.Redirect(s2.URL, nil); s.Delivered != 1 {
+		t.Fatalf("redirect delivered to %d clients", s.Delivered)
+	}
+	time.Sleep(CLIENT_DELAY)
+	h2.Send(&Event{ID: "1"})
+	select {
+	case e := <-c.Events:
+		if e.ID != "1" {
+			t.Fatalf("unexpected event %+v", e)
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestClientLongPollInterval(t *testing.T) {
+	reqChan := make(chan any, 2)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		reqChan <- nil
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	clock := &testClock{now: time.Now()}
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:              []string{s.URL + "/sse"},
+		LongPollURL:       s.URL + "/poll",
+		LongPollInterval:  time.Second,
+		FallbackThreshold: 1,
+		Clock:             clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-reqChan
+	for clock.NumWaiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-reqChan:
+		t.Fatal("client polled before the interval elapsed")
+	case <-time.After(CLIENT_DELAY):
+	}
+	clock.Advance(time.Second)
+	select {
+	case <-reqChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not poll after the interval elapsed")
+	}
+}
+
+func TestClientFallbackRetry(t *testing.T) {
+	var (
+		sseFailed atomic.Bool
+		pollChan  = make(chan any, 2)
+		mux       = http.NewServeMux()
+	)
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		if !sseFailed.Swap(true) {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Write([]byte("data:sse\n\n"))
+	})
+	mux.HandleFunc("/poll", func(w http.ResponseWriter, r *http.Request) {
+		pollChan <- nil
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	clock := &testClock{now: time.Now()}
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:                  []string{s.URL + "/sse"},
+		LongPollURL:           s.URL + "/poll",
+		LongPollInterval:      time.Second,
+		FallbackThreshold:     1,
+		FallbackRetryInterval: time.Minute,
+		Clock:                 clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-pollChan
+	for clock.NumWaiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+	select {
+	case e := <-c.Events:
+		if e.Data != "sse" {
+			t.Fatalf("%#v != %#v", e.Data, "sse")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not return to SSE")
+	}
+}
@@ -0,0 +1,28 @@
+package sse
+
+import (
+	"time"
+)
+
+// Clock provides the current time and timers. Supplying an alternative
+// implementation allows tests to control the passage of time instead of
+// waiting for it.
+type Clock interface {
+
+	// Now returns the current time.
+	Now() time.Time
+
+	// After returns a channel that receives the current time once the
+	// duration has elapsed.
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
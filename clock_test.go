@@ -0,0 +1,97 @@
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testClockWaiter struct {
+	t time.Time
+	c chan time.Time
+}
+
+// testClock is a Clock that only advances when instructed to.
+type testClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*testClockWaiter
+}
+
+func (c *testClock) Now() time.Time {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	return c.now
+}
+
+func (c *testClock) After(d time.Duration) <-chan time.Time {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	w := &testClockWaiter{t: c.now.Add(d), c: make(chan time.Time, 1)}
+	if d <= 0 {
+		w.c <- c.now
+	} else {
+		c.waiters = append(c.waiters, w)
+	}
+	return w.c
+}
+
+func (c *testClock) Advance(d time.Duration) {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	c.now = c.now.Add(d)
+	waiters := []*testClockWaiter{}
+	for _, w := range c.waiters {
+		if w.t.After(c.now) {
+			waiters = append(waiters, w)
+		} else {
+			w.c <- c.now
+		}
+	}
+	c.waiters = waiters
+}
+
+func (c *testClock) NumWaiters() int {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	return len(c.waiters)
+}
+
+func TestClientClock(t *testing.T) {
+	reqChan := make(chan any, 2)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			reqChan <- nil
+			w.WriteHeader(http.StatusServiceUnavailable)
+		},
+	))
+	defer s.Close()
+	clock := &testClock{now: time.Now()}
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:  []string{s.URL},
+		Clock: clock,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	<-reqChan
+
+	// Wait for the client to begin waiting to reconnect
+	for clock.NumWaiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-reqChan:
+		t.Fatal("client reconnected before the clock advanced")
+	default:
+	}
+	clock.Advance(defaultReconnectionTime)
+	select {
+	case <-reqChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not reconnect after the clock advanced")
+	}
+}
@@ -0,0 +1,296 @@
+package sse
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// connection maintains the state of a single client connection.
+type connection struct {
+	id          uint64
+	remoteAddr  string
+	remoteIP    string
+	stream      string
+	connectedAt time.Time
+	value       any
+	key         any
+	topics      map[string]struct{}
+	audiences   map[string]struct{}
+	buffer      *ringBuffer
+	reason      DisconnectReason
+	terminate   func()
+	lastWrite   atomic.Int64
+	lagged      bool
+
+	// subscriber is true for in-process subscribers created by Subscribe,
+	// which do not count toward the connection limits
+	subscriber bool
+
+	// numShed counts the events discarded due to the memory budget since
+	// the client was last notified
+	numShed atomic.Uint64
+
+	// cfg controls how events are queued for the connection
+	cfg *HandlerConfig
+}
+
+// shedEvent returns an event notifying the client of the number of events
+// discarded due to the memory budget since it was last notified, or nil if
+// there were none.
+func (c *connection) shedEvent() *Event {
+	n := c.numShed.Swap(0)
+	if n == 0 {
+		return nil
+	}
+	return &Event{
+		Type: EventsDroppedEventType,
+		Data: strconv.FormatUint(n, 10),
+	}
+}
+
+// lastWriteAt returns the time of the last successful write.
+func (c *connection) lastWriteAt() time.Time {
+	if n := c.lastWrite.Load(); n != 0 {
+		return time.Unix(0, n)
+	}
+	return time.Time{}
+}
+
+// info returns information about the connection.
+func (c *connection) info() *ConnectionInfo {
+	lag, dropped, conflated := c.buffer.stats()
+	return &ConnectionInfo{
+		ID:          c.id,
+		RemoteAddr:  c.remoteAddr,
+		ConnectedAt: c.connectedAt,
+		Value:       c.value,
+		Lag:         lag,
+		Dropped:     dropped,
+		Conflated:   conflated,
+		LastWriteAt: c.lastWriteAt(),
+	}
+}
+
+// wants determines whether the event should be delivered on the connection
+// based on its stream, topic, and target.
+func (c *connection) wants(e *Event) bool {
+	if e.stream != c.stream {
+		return false
+	}
+	if e.Topic != "" {
+		if _, ok := c.topics[e.Topic]; !ok {
+			return false
+		}
+	}
+	if len(e.Audience) != 0 && !c.inAudience(e.Audience) {
+		return false
+	}
+	if e.match != nil && !e.match(c.value) {
+		return false
+	}
+	if e.target != nil {
+		return (c.key == e.target) != e.excludeTarget
+	}
+	return true
+}
+
+// inAudience determines if the connection is a member of any of the
+// audiences.
+func (c *connection) inAudience(audiences []string) bool {
+	for _, a := range audiences {
+		if _, ok := c.audiences[a]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueue attempts to add the event to the connection's buffer, evicting a non-critical
+// event if the event is critical and otherwise following the slow client
+// policy. The return value is false if the client should be disconnected.
+func (c *connection) enqueue(e *Event) bool {
+	if c.cfg.ConflationKeyFn != nil {
+		if key := c.cfg.ConflationKeyFn(e); key != "" {
+			replaced, ok := c.buffer.pushReplace(e, func(queued *Event) bool {
+				return c.cfg.ConflationKeyFn(queued) == key
+			}, true)
+			if ok {
+				replaced.markWritten()
+				return true
+			}
+		}
+	}
+	if c.buffer.push(e) {
+		return true
+	}
+	if e.Critical {
+		if evicted, ok := c.buffer.pushEvict(e); ok {
+			evicted.markWritten()
+			return true
+		}
+	}
+	switch c.cfg.SlowClientPolicy {
+	case SlowClientDropOldest:
+		if dropped := c.buffer.pushDropOldest(e); dropped != nil {
+			dropped.markWritten()
+		}
+		return true
+	case SlowClientBlock:
+		return c.buffer.pushWait(e, c.cfg.SlowClientTimeout)
+	}
+	return false
+}
+
+// checkLag invokes LaggedFn if the connection has started lagging since it
+// was last checked.
+func (c *connection) checkLag() {
+	if c.cfg.LaggedFn == nil {
+		return
+	}
+	lastWriteAt := c.lastWriteAt()
+	if lastWriteAt.IsZero() {
+		lastWriteAt = c.connectedAt
+	}
+	lag := c.buffer.len()
+	lagged := (c.cfg.LagThreshold != 0 && lag >= c.cfg.LagThreshold) ||
+		(c.cfg.LagDuration != 0 && lag != 0 &&
+			time.Since(lastWriteAt) >= c.cfg.LagDuration)
+	if lagged && !c.lagged {
+		go c.cfg.LaggedFn(c.info())
+	}
+	c.lagged = lagged
+}
+
+// connSet is a set of connections.
+type connSet map[*connection]struct{}
+
+// shard is a partition of the connections to a stream. Events are delivered
+// to the connections in a shard one at a time and in the order in which they
+// were sent, but without holding the Broker's mutex, allowing different
+// shards to be delivered to in parallel.
+type shard struct {
+
+	// conns is replaced rather than modified so that it can be delivered to
+	// while connections are being added and removed; it and next are
+	// protected by the Broker's mutex
+	conns []*connection
+	next  uint64
+
+	// turn is the ticket of the delivery that may proceed
+	mutex sync.Mutex
+	cond  *sync.Cond
+	turn  uint64
+}
+
+func newShard() *shard {
+	s := &shard{}
+	s.cond = sync.NewCond(&s.mutex)
+	return s
+}
+
+// ticket reserves a place in the shard's delivery order. The Broker's mutex
+// must be held when calling this method.
+func (s *shard) ticket() uint64 {
+	t := s.next
+	s.next++
+	return t
+}
+
+// wait blocks until it is the turn of the delivery with the provided ticket.
+func (s *shard) wait(ticket uint64) {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	for s.turn != ticket {
+		s.cond.Wait()
+	}
+}
+
+// done ends the current delivery, allowing the next one to proceed.
+func (s *shard) done() {
+	s.mutex.Lock()
+	s.turn++
+	s.mutex.Unlock()
+	s.cond.Broadcast()
+}
+
+// add adds the connection to the shard. The Broker's mutex must be held when
+// calling this method.
+func (s *shard) add(conn *connection) {
+	conns := make([]*connection, len(s.conns), len(s.conns)+1)
+	copy(conns, s.conns)
+	s.conns = append(conns, conn)
+}
+
+// remove removes the connection from the shard. The Broker's mutex must be
+// held when calling this method.
+func (s *shard) remove(conn *connection) {
+	conns := make([]*connection, 0, len(s.conns))
+	for _, c := range s.conns {
+		if c != conn {
+			conns = append(conns, c)
+		}
+	}
+	s.conns = conns
+}
+
+// shards partitions the connections to a stream.
+type shards []*shard
+
+func newShards(n int) shards {
+	if n < 1 {
+		n = 1
+	}
+	s := make(shards, n)
+	for i := range s {
+		s[i] = newShard()
+	}
+	return s
+}
+
+// shardFor returns the shard that the connection belongs to.
+func (s shards) shardFor(conn *connection) *shard {
+	return s[conn.id%uint64(len(s))]
+}
+
+// len returns the total number of connections in all shards.
+func (s shards) len() int {
+	n := 0
+	for _, shard := range s {
+		n += len(shard.conns)
+	}
+	return n
+}
+
+// topicKey identifies a topic within a stream.
+type topicKey struct {
+	stream string
+	topic  string
+}
+
+// addToIndex adds the connection to the index under the provided key.
+func addToIndex[K comparable](index map[K]connSet, k K, conn *connection) {
+	conns, ok := index[k]
+	if !ok {
+		conns = make(connSet)
+		index[k] = conns
+	}
+	conns[conn] = struct{}{}
+}
+
+// removeFromIndex removes the connection from the index under the provided
+// key.
+func removeFromIndex[K comparable](index map[K]connSet, k K, conn *connection) {
+	conns := index[k]
+	delete(conns, conn)
+	if len(conns) == 0 {
+		delete(index, k)
+	}
+}
+
+// isComparable determines if the value can be used as a map key.
+func isComparable(v any) bool {
+	return v != nil && reflect.TypeOf(v).Comparable()
+}
@@ -0,0 +1,88 @@
+package sse
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// allowedOrigin returns the value for the Access-Control-Allow-Origin header
+// or an empty string if the origin is not allowed.
+func (h *Handler) allowedOrigin(origin string) string {
+	for _, o := range h.cfg.AllowedOrigins {
+		if o == "*" {
+			if h.cfg.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if strings.EqualFold(o, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// trustedOrigin determines if the request's origin is permitted to connect.
+func (h *Handler) trustedOrigin(r *http.Request) bool {
+	if len(h.cfg.TrustedOrigins) == 0 && h.cfg.OriginFn == nil {
+		return true
+	}
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, o := range h.cfg.TrustedOrigins {
+		if strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	if h.cfg.OriginFn != nil && h.cfg.OriginFn(origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// handleCORS writes the CORS headers for the request if it contains an
+// allowed Origin. OPTIONS requests never open a stream: they are refused if
+// they come from an origin that is not allowed and answered with a 204
+// response otherwise. The return value is true if the request has been
+// responded to.
+func (h *Handler) handleCORS(w http.ResponseWriter, r *http.Request) bool {
+	var (
+		origin      = r.Header.Get("Origin")
+		allowOrigin string
+	)
+	if origin != "" && len(h.cfg.AllowedOrigins) != 0 {
+		w.Header().Add("Vary", "Origin")
+		allowOrigin = h.allowedOrigin(origin)
+	}
+	if allowOrigin != "" {
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if h.cfg.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+	if r.Method != http.MethodOptions {
+		return false
+	}
+	if origin != "" && allowOrigin == "" {
+		http.Error(
+			w,
+			http.StatusText(http.StatusForbidden),
+			http.StatusForbidden,
+		)
+		return true
+	}
+	if allowOrigin != "" && r.Header.Get("Access-Control-Request-Method") != "" {
+		w.Header().Set("Access-Control-Allow-Methods", "GET")
+		w.Header().Set(
+			"Access-Control-Allow-Headers",
+			strings.Join(append([]string{"Last-Event-ID"}, h.cfg.AllowedHeaders...), ", "),
+		)
+	}
+	w.Header().Set("Allow", "GET, OPTIONS")
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
@@ -0,0 +1,160 @@
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerCORS(t *testing.T) {
+	for _, v := range []struct {
+		Name         string
+		Config       *HandlerConfig
+		Method       string
+		Header       http.Header
+		StatusCode   int
+		AllowOrigin  string
+		AllowHeaders string
+	}{
+		{
+			Name:       "no CORS",
+			Config:     &HandlerConfig{},
+			Method:     http.MethodGet,
+			Header:     http.Header{"Origin": []string{"http://a.com"}},
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "origin not allowed",
+			Config:     &HandlerConfig{AllowedOrigins: []string{"http://b.com"}},
+			Method:     http.MethodGet,
+			Header:     http.Header{"Origin": []string{"http://a.com"}},
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:        "any origin",
+			Config:      &HandlerConfig{AllowedOrigins: []string{"*"}},
+			Method:      http.MethodGet,
+			Header:      http.Header{"Origin": []string{"http://a.com"}},
+			StatusCode:  http.StatusOK,
+			AllowOrigin: "*",
+		},
+		{
+			Name: "preflight",
+			Config: &HandlerConfig{
+				AllowedOrigins: []string{"http://a.com"},
+				AllowedHeaders: []string{"Authorization"},
+			},
+			Method: http.MethodOptions,
+			Header: http.Header{
+				"Origin":                        []string{"http://a.com"},
+				"Access-Control-Request-Method": []string{"GET"},
+			},
+			StatusCode:   http.StatusNoContent,
+			AllowOrigin:  "http://a.com",
+			AllowHeaders: "Last-Event-ID, Authorization",
+		},
+		{
+			Name:   "preflight from origin not allowed",
+			Config: &HandlerConfig{AllowedOrigins: []string{"http://b.com"}},
+			Method: http.MethodOptions,
+			Header: http.Header{
+				"Origin":                        []string{"http://a.com"},
+				"Access-Control-Request-Method": []string{"GET"},
+			},
+			StatusCode: http.StatusForbidden,
+		},
+		{
+			Name:   "preflight without CORS",
+			Config: &HandlerConfig{},
+			Method: http.MethodOptions,
+			Header: http.Header{
+				"Origin":                        []string{"http://a.com"},
+				"Access-Control-Request-Method": []string{"GET"},
+			},
+			StatusCode: http.StatusForbidden,
+		},
+		{
+			Name:       "options without origin",
+			Config:     &HandlerConfig{AllowedOrigins: []string{"http://b.com"}},
+			Method:     http.MethodOptions,
+			Header:     http.Header{},
+			StatusCode: http.StatusNoContent,
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			h = NewHandler(v.Config)
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(v.Method, "/", nil).WithContext(ctx)
+		)
+		r.Header = v.Header
+		h.ServeHTTP(w, r)
+		h.Close()
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+		if o := w.Header().Get("Access-Control-Allow-Origin"); o != v.AllowOrigin {
+			t.Fatalf("%s: %#v != %#v", v.Name, o, v.AllowOrigin)
+		}
+		if h := w.Header().Get("Access-Control-Allow-Headers"); h != v.AllowHeaders {
+			t.Fatalf("%s: %#v != %#v", v.Name, h, v.AllowHeaders)
+		}
+	}
+}
+
+func TestHandlerTrustedOrigins(t *testing.T) {
+	for _, v := range []struct {
+		Name       string
+		Origin     string
+		StatusCode int
+	}{
+		{
+			Name:       "no origin",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "trusted origin",
+			Origin:     "https://A.com",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "same origin",
+			Origin:     "http://example.com",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "accepted by OriginFn",
+			Origin:     "https://sub.b.com",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "untrusted origin",
+			Origin:     "https://evil.com",
+			StatusCode: http.StatusForbidden,
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			h = NewHandler(&HandlerConfig{
+				TrustedOrigins: []string{"https://a.com"},
+				OriginFn: func(origin string) bool {
+					return strings.HasSuffix(origin, ".b.com")
+				},
+			})
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		if v.Origin != "" {
+			r.Header.Set("Origin", v.Origin)
+		}
+		h.ServeHTTP(w, r)
+		h.Close()
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package sse
+
+import (
+	"hash/fnv"
+	"runtime"
+	"sync"
+)
+
+// DispatchOrdering determines the order in which a Dispatcher's workers
+// process events.
+type DispatchOrdering int
+
+const (
+
+	// DispatchUnordered hands each event to the next available worker.
+	// Events may be processed in any order.
+	DispatchUnordered DispatchOrdering = iota
+
+	// DispatchOrderedByKey hands every event with the same key to the same
+	// worker, ensuring that they are processed in the order received.
+	DispatchOrderedByKey
+)
+
+// defaultWorkerBufferSize is used when WorkerBufferSize is not set.
+const defaultWorkerBufferSize = 64
+
+// DispatcherConfig provides a means of passing configuration to
+// NewDispatcher.
+type DispatcherConfig struct {
+
+	// NumWorkers indicates how many goroutines should process events. If
+	// set to the zero value, runtime.NumCPU() is used.
+	NumWorkers int
+
+	// Ordering determines the order in which events are processed.
+	Ordering DispatchOrdering
+
+	// KeyFn, if provided, returns the key used for ordering events with
+	// DispatchOrderedByKey. If not provided, the event ID is used.
+	KeyFn func(*Event) string
+
+	// WorkerBufferSize indicates how many events may be queued for each
+	// worker with DispatchOrderedByKey, allowing events for other workers to
+	// be processed while one is busy. The default value is 64.
+	WorkerBufferSize int
+
+	// EventFn is invoked by the workers for each event and must be provided.
+	EventFn func(*Event)
+}
+
+// Dispatcher fans events out to a pool of worker goroutines.
+type Dispatcher struct {
+	waitGroup sync.WaitGroup
+}
+
+func (d *Dispatcher) worker(eventChan <-chan *Event, fn func(*Event)) {
+	defer d.waitGroup.Done()
+	for e := range eventChan {
+		fn(e)
+	}
+}
+
+func (d *Dispatcher) route(
+	eventChan <-chan *Event,
+	workerChans []chan *Event,
+	keyFn func(*Event) string,
+) {
+	defer func() {
+		for _, c := range workerChans {
+			close(c)
+		}
+	}()
+	for e := range eventChan {
+		h := fnv.New32a()
+		h.Write([]byte(keyFn(e)))
+		workerChans[h.Sum32()%uint32(len(workerChans))] <- e
+	}
+}
+
+// NewDispatcher creates a new Dispatcher that reads events from the provided
+// channel (usually Client.Events) until it is closed. If cfg.Ordering is
+// DispatchOrderedByKey, each worker receives its events on a separate
+// buffered channel, so a slow event delays the others with the same key (and
+// any other keys handled by the same worker). Once a worker's buffer is full,
+// reading stops until it has room, delaying every key.
+func NewDispatcher(eventChan <-chan *Event, cfg *DispatcherConfig) *Dispatcher {
+	var (
+		d          = &Dispatcher{}
+		numWorkers = cfg.NumWorkers
+	)
+	if numWorkers <= 0 {
+		numWorkers = runtime.NumCPU()
+	}
+	d.waitGroup.Add(numWorkers)
+	if cfg.Ordering == DispatchUnordered {
+		for i := 0; i < numWorkers; i++ {
+			go d.worker(eventChan, cfg.EventFn)
+		}
+		return d
+	}
+	keyFn := cfg.KeyFn
+	if keyFn == nil {
+		keyFn = func(e *Event) string {
+			return e.ID
+		}
+	}
+	bufferSize := cfg.WorkerBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultWorkerBufferSize
+	}
+	workerChans := make([]chan *Event, numWorkers)
+	for i := range workerChans {
+		workerChans[i] = make(chan *Event, bufferSize)
+		go d.worker(workerChans[i], cfg.EventFn)
+	}
+	go d.route(eventChan, workerChans, keyFn)
+	return d
+}
+
+// Wait blocks until the event channel is closed and all events have been
+// processed.
+func (d *Dispatcher) Wait() {
+	d.waitGroup.Wait()
+}
@@ -0,0 +1,108 @@
+package sse
+
+import (
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDispatcher(t *testing.T) {
+	for _, v := range []struct {
+		Name     string
+		Ordering DispatchOrdering
+	}{
+		{
+			Name:     "unordered",
+			Ordering: DispatchUnordered,
+		},
+		{
+			Name:     "ordered by key",
+			Ordering: DispatchOrderedByKey,
+		},
+	} {
+		var (
+			mutex     sync.Mutex
+			received  = map[string][]string{}
+			eventChan = make(chan *Event)
+			d         = NewDispatcher(eventChan, &DispatcherConfig{
+				NumWorkers: 4,
+				Ordering:   v.Ordering,
+				KeyFn: func(e *Event) string {
+					return e.Type
+				},
+				EventFn: func(e *Event) {
+					defer mutex.Unlock()
+					mutex.Lock()
+					received[e.Type] = append(received[e.Type], e.Data)
+				},
+			})
+			expected = map[string][]string{}
+		)
+		for i := 0; i < 100; i++ {
+			var (
+				eventType = strconv.Itoa(i % 3)
+				eventData = strconv.Itoa(i)
+			)
+			eventChan <- &Event{Type: eventType, Data: eventData}
+			expected[eventType] = append(expected[eventType], eventData)
+		}
+		close(eventChan)
+		d.Wait()
+		if v.Ordering == DispatchUnordered {
+			n := 0
+			for _, l := range received {
+				n += len(l)
+			}
+			if n != 100 {
+				t.Fatalf("%s: %#v != %#v", v.Name, n, 100)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(received, expected) {
+			t.Fatalf("%s: %#v != %#v", v.Name, received, expected)
+		}
+	}
+}
+
+func TestDispatcherBlockedWorker(t *testing.T) {
+	var (
+		blockChan = make(chan any)
+		bChan     = make(chan any, 10)
+		eventChan = make(chan *Event)
+		d         = NewDispatcher(eventChan, &DispatcherConfig{
+			NumWorkers: 2,
+			Ordering:   DispatchOrderedByKey,
+			KeyFn: func(e *Event) string {
+				return e.Type
+			},
+			EventFn: func(e *Event) {
+				if e.Type == "a" {
+					<-blockChan
+				} else {
+					bChan <- nil
+				}
+			},
+		})
+	)
+	defer d.Wait()
+	defer close(blockChan)
+
+	// "a" and "b" are handled by different workers; blocking the worker for
+	// "a" must not prevent events for "b" from being processed
+	go func() {
+		defer close(eventChan)
+		for i := 0; i < 10; i++ {
+			eventChan <- &Event{Type: "a"}
+			eventChan <- &Event{Type: "b"}
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		select {
+		case <-bChan:
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("events for other keys were blocked")
+		}
+	}
+}
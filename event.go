@@ -2,7 +2,11 @@ package sse
 
 import (
 	"bytes"
-	"fmt"
+	"encoding/json"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,34 +17,202 @@ const (
 	fieldNameData  = "data"
 	fieldNameID    = "id"
 	fieldNameRetry = "retry"
+	fieldNameSeq   = "seq"
+
+	// HeartbeatEventType is the type of events that carry a Heartbeat as
+	// their JSON-encoded data.
+	HeartbeatEventType = "heartbeat"
+
+	// RedirectEventType is the type of events that instruct clients to
+	// reconnect to the URL in their data (see Handler.Redirect).
+	RedirectEventType = "redirect"
+
+	// ResyncRequiredEventType is the type of events that instruct clients to
+	// fetch a full snapshot of the state since events were missed (see
+	// UnknownEventIDResync).
+	ResyncRequiredEventType = "resync-required"
+
+	// EventsDroppedEventType is the type of events that inform clients of the
+	// number of events (in their data) that were not delivered to them due
+	// to MaxBufferedBytes in HandlerConfig.
+	EventsDroppedEventType = "events-dropped"
 )
 
+// Heartbeat provides the server's wall-clock time and the ID of the latest
+// event sent, allowing clients to measure delivery lag and detect that they
+// are connected but no longer receiving events.
+type Heartbeat struct {
+	Time        time.Time `json:"time"`
+	LastEventID string    `json:"lastEventId,omitempty"`
+}
+
+// newHeartbeatEvent creates an event containing a Heartbeat with the current
+// time.
+func newHeartbeatEvent(lastEventID string) *Event {
+	b, _ := json.Marshal(&Heartbeat{
+		Time:        time.Now(),
+		LastEventID: lastEventID,
+	})
+	return &Event{
+		Type: HeartbeatEventType,
+		Data: string(b),
+	}
+}
+
 // Event represents an individual event from the event stream.
 type Event struct {
 	Type string
 	Data string
 	ID   string
 
-	// Retry is only used when sending events, not receiving them.
+	// Retry is the reconnection time sent with the event. When receiving
+	// events, it is set if a retry field preceded the event.
 	Retry time.Duration
 
+	// Sequence is the event's position in the global sequence assigned by a
+	// Broker with EnableSequence set. It is sent to clients in a "seq" field
+	// (which browsers ignore) and is set when receiving events, allowing
+	// clients to detect gaps. Note that events a client does not receive,
+	// such as those for other topics, also appear as gaps.
+	Sequence uint64
+
+	// TTL, if nonzero, limits how long the event is retained for replay to
+	// reconnecting clients. It is only used when sending events.
+	TTL time.Duration
+
 	// UserData is useful for filtering events with FilterFn in HandlerConfig.
 	UserData any
+
+	// Audience, if set, restricts delivery by a Handler to clients that are a
+	// member of at least one of the audiences (see AudienceFn in
+	// HandlerConfig). It is not sent to clients.
+	Audience []string
+
+	// Critical indicates that the event must not be discarded by a Handler
+	// when a client's buffer is full. Instead, the oldest queued event that
+	// is not critical is discarded to make room. It is not sent to clients.
+	Critical bool
+
+	// Topic, if set, restricts delivery by a Handler to clients subscribed to
+	// the topic. It is not sent to clients.
+	Topic string
+
+	// stream is set by SendToStream to deliver the event to a stream other
+	// than the default one
+	stream string
+
+	// target, excludeTarget, and match are set by the Handler's targeted send
+	// methods to restrict delivery to (or away from) specific clients
+	target        any
+	excludeTarget bool
+	match         func(any) bool
+
+	// ephemeral events are not added to the Handler's EventStore
+	ephemeral bool
+
+	// encoded caches the result of Bytes for events sent by a Handler
+	encoded []byte
+
+	// written is set by SendContext and is decremented once the event has
+	// been written to (or can no longer be written to) each client
+	written *sync.WaitGroup
 }
 
-// Bytes returns the byte representation of the event. Note that the result is
-// only valid if Type, Data, and ID do NOT contain a CR or LF.
-func (e *Event) Bytes() []byte {
-	b := &bytes.Buffer{}
+// encodedBytes returns the cached byte representation of the event if
+// available, avoiding encoding it again.
+func (e *Event) encodedBytes() []byte {
+	if e.encoded != nil {
+		return e.encoded
+	}
+	return e.Bytes()
+}
+
+// markWritten indicates that a client is done with the event.
+func (e *Event) markWritten() {
+	if e.written != nil {
+		e.written.Done()
+	}
+}
+
+// maxPooledBufferSize prevents unusually large buffers from being retained
+const maxPooledBufferSize = 64 * 1024
+
+var bufferPool = sync.Pool{
+	New: func() any {
+		return &bytes.Buffer{}
+	},
+}
+
+func getBuffer() *bytes.Buffer {
+	b := bufferPool.Get().(*bytes.Buffer)
+	b.Reset()
+	return b
+}
+
+func putBuffer(b *bytes.Buffer) {
+	if b.Cap() <= maxPooledBufferSize {
+		bufferPool.Put(b)
+	}
+}
+
+func (e *Event) encode(b *bytes.Buffer) {
 	if e.Type != "" {
-		fmt.Fprintf(b, "event:%s\r", e.Type)
+		b.WriteString("event:")
+		b.WriteString(e.Type)
+		b.WriteByte('\r')
 	}
 	if e.ID != "" {
-		fmt.Fprintf(b, "id:%s\r", e.ID)
+		b.WriteString("id:")
+		b.WriteString(e.ID)
+		b.WriteByte('\r')
+	}
+	if e.Sequence != 0 {
+		var n [20]byte
+		b.WriteString("seq:")
+		b.Write(strconv.AppendUint(n[:0], e.Sequence, 10))
+		b.WriteByte('\r')
 	}
 	if e.Retry != 0 {
-		fmt.Fprintf(b, "retry:%d\r", e.Retry.Milliseconds())
+		var n [20]byte
+		b.WriteString("retry:")
+		b.Write(strconv.AppendInt(n[:0], e.Retry.Milliseconds(), 10))
+		b.WriteByte('\r')
+	}
+	data := e.Data
+	for {
+		i := strings.IndexByte(data, '\n')
+		if i == -1 {
+			break
+		}
+		b.WriteString("data:")
+		b.WriteString(data[:i])
+		b.WriteByte('\r')
+		data = data[i+1:]
+	}
+	b.WriteString("data:")
+	b.WriteString(data)
+	b.WriteString("\r\r")
+}
+
+// Bytes returns the byte representation of the event. Data containing LF is
+// split across multiple lines. Note that the result is only valid if Type and
+// ID do NOT contain a CR or LF and Data does NOT contain a CR.
+func (e *Event) Bytes() []byte {
+	b := getBuffer()
+	defer putBuffer(b)
+	e.encode(b)
+	return append([]byte(nil), b.Bytes()...)
+}
+
+// WriteTo writes the byte representation of the event to w using a pooled
+// buffer, avoiding the allocation made by Bytes. The same restrictions apply.
+func (e *Event) WriteTo(w io.Writer) (int64, error) {
+	if e.encoded != nil {
+		n, err := w.Write(e.encoded)
+		return int64(n), err
 	}
-	fmt.Fprintf(b, "data:%s\r\r", e.Data)
-	return b.Bytes()
+	b := getBuffer()
+	defer putBuffer(b)
+	e.encode(b)
+	return b.WriteTo(w)
 }
@@ -1,6 +1,7 @@
 package sse
 
 import (
+	"bytes"
 	"testing"
 	"time"
 )
@@ -26,10 +27,27 @@ func TestBytes(t *testing.T) {
 			Event:  &Event{Retry: 1 * time.Second},
 			Output: "retry:1000\rdata:\r\r",
 		},
+		{
+			Name:   "event with multiline data",
+			Event:  &Event{Data: "a\nb"},
+			Output: "data:a\rdata:b\r\r",
+		},
+		{
+			Name:   "event with sequence",
+			Event:  &Event{ID: "a", Sequence: 5},
+			Output: "id:a\rseq:5\rdata:\r\r",
+		},
 	} {
 		b := v.Event.Bytes()
 		if string(b) != v.Output {
 			t.Fatalf("%s: %#v != %#v", v.Name, string(b), v.Output)
 		}
+		w := &bytes.Buffer{}
+		if _, err := v.Event.WriteTo(w); err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if w.String() != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.String(), v.Output)
+		}
 	}
 }
@@ -0,0 +1,335 @@
+package sse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+)
+
+const (
+	graphQLNextEventType     = "next"
+	graphQLCompleteEventType = "complete"
+	graphQLTokenHeader       = "X-GraphQL-Event-Stream-Token"
+)
+
+var errConnectionClosedByClient = errors.New("connection has been closed")
+
+// GraphQLRequest is a GraphQL operation sent to a graphql-sse server.
+type GraphQLRequest struct {
+	Query         string         `json:"query"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	OperationName string         `json:"operationName,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLError is an error included in a GraphQLResult.
+type GraphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+// GraphQLResult is an execution result delivered in a "next" event.
+type GraphQLResult struct {
+	Data       json.RawMessage `json:"data,omitempty"`
+	Errors     []*GraphQLError `json:"errors,omitempty"`
+	Extensions map[string]any  `json:"extensions,omitempty"`
+}
+
+// DecodeGraphQLResult decodes the result contained in a "next" event received
+// by a client created with NewGraphQLClient.
+func DecodeGraphQLResult(e *Event) (*GraphQLResult, error) {
+	if e.Type != graphQLNextEventType {
+		return nil, fmt.Errorf("unexpected event type %#v", e.Type)
+	}
+	r := &GraphQLResult{}
+	if err := json.Unmarshal([]byte(e.Data), r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func newGraphQLRequest(
+	ctx context.Context,
+	method, rawURL string,
+	body any,
+) (*http.Request, error) {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, r)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
+
+// NewGraphQLClient creates a new client that executes a single operation using
+// the "distinct connections" mode of the graphql-sse protocol. Results are
+// delivered as "next" events (see DecodeGraphQLResult) and the client shuts
+// down when the operation completes. Any other options are taken from
+// clientCfg, which may be nil.
+func NewGraphQLClient(
+	rawURL string,
+	req *GraphQLRequest,
+	clientCfg *ClientConfig,
+) (*Client, error) {
+	r, err := newGraphQLRequest(context.Background(), http.MethodPost, rawURL, req)
+	if err != nil {
+		return nil, err
+	}
+	cfgCopy := ClientConfig{}
+	if clientCfg != nil {
+		cfgCopy = *clientCfg
+	}
+	cfgCopy.Request = r
+	cfgCopy.URLs = nil
+	cfgCopy.TerminalEventTypes = append(
+		[]string{graphQLCompleteEventType},
+		cfgCopy.TerminalEventTypes...,
+	)
+	return NewClientFromConfig(&cfgCopy)
+}
+
+type graphQLMessage struct {
+	ID      string         `json:"id"`
+	Payload *GraphQLResult `json:"payload"`
+}
+
+// GraphQLSubscription represents an operation executed on a
+// GraphQLConnection.
+type GraphQLSubscription struct {
+
+	// ID uniquely identifies the operation on the connection.
+	ID string
+
+	// Results provides the results of the operation and is closed once the
+	// operation completes or is canceled. It must be drained continuously
+	// since it shares the connection with other operations.
+	Results <-chan *GraphQLResult
+
+	mutex       sync.Mutex
+	conn        *GraphQLConnection
+	resultsChan chan *GraphQLResult
+	doneChan    chan any
+	doneOnce    sync.Once
+	closed      bool
+}
+
+func (s *GraphQLSubscription) close() {
+	s.doneOnce.Do(func() {
+		close(s.doneChan)
+	})
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.resultsChan)
+	}
+}
+
+func (s *GraphQLSubscription) send(r *GraphQLResult) {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.resultsChan <- r:
+	case <-s.doneChan:
+	}
+}
+
+// Cancel stops the operation on the server and closes the Results channel.
+func (s *GraphQLSubscription) Cancel(ctx context.Context) error {
+	s.conn.remove(s.ID)
+	s.close()
+	u, err := url.Parse(s.conn.url)
+	if err != nil {
+		return err
+	}
+	q := u.Query()
+	q.Set("operationId", s.ID)
+	u.RawQuery = q.Encode()
+	_, err = s.conn.do(ctx, http.MethodDelete, u.String(), nil, http.StatusOK)
+	return err
+}
+
+// GraphQLConnection executes any number of operations over a single event
+// stream using the "single connection" mode of the graphql-sse protocol.
+type GraphQLConnection struct {
+	mutex         sync.Mutex
+	url           string
+	token         string
+	httpClient    *http.Client
+	client        *Client
+	subscriptions map[string]*GraphQLSubscription
+	nextID        int
+	closed        bool
+}
+
+func (c *GraphQLConnection) do(
+	ctx context.Context,
+	method, rawURL string,
+	body any,
+	statusCode int,
+) ([]byte, error) {
+	req, err := newGraphQLRequest(ctx, method, rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set(graphQLTokenHeader, c.token)
+	}
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Body.Close()
+	b, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if r.StatusCode != statusCode {
+		return nil, fmt.Errorf("unexpected status code %d", r.StatusCode)
+	}
+	return b, nil
+}
+
+func (c *GraphQLConnection) remove(id string) {
+	defer c.mutex.Unlock()
+	c.mutex.Lock()
+	delete(c.subscriptions, id)
+}
+
+func (c *GraphQLConnection) dispatch(e *Event) error {
+	m := &graphQLMessage{}
+	if err := json.Unmarshal([]byte(e.Data), m); err != nil {
+		return nil
+	}
+	c.mutex.Lock()
+	s, ok := c.subscriptions[m.ID]
+	if ok && e.Type == graphQLCompleteEventType {
+		delete(c.subscriptions, m.ID)
+	}
+	c.mutex.Unlock()
+	if !ok {
+		return nil
+	}
+	switch e.Type {
+	case graphQLNextEventType:
+		if m.Payload != nil {
+			s.send(m.Payload)
+		}
+	case graphQLCompleteEventType:
+		s.close()
+	}
+	return nil
+}
+
+// NewGraphQLConnection reserves an event stream on a graphql-sse server and
+// connects to it. Any other options are taken from clientCfg, which may be
+// nil. OnEvent is used internally and must not be set.
+func NewGraphQLConnection(
+	ctx context.Context,
+	rawURL string,
+	clientCfg *ClientConfig,
+) (*GraphQLConnection, error) {
+	cfgCopy := ClientConfig{}
+	if clientCfg != nil {
+		cfgCopy = *clientCfg
+	}
+	c := &GraphQLConnection{
+		url:           rawURL,
+		httpClient:    cfgCopy.Client,
+		subscriptions: make(map[string]*GraphQLSubscription),
+	}
+	if c.httpClient == nil {
+		c.httpClient = http.DefaultClient
+	}
+	token, err := c.do(ctx, http.MethodPut, rawURL, nil, http.StatusCreated)
+	if err != nil {
+		return nil, err
+	}
+	c.token = string(token)
+	r, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	r.Header.Set(graphQLTokenHeader, c.token)
+	cfgCopy.Request = r
+	cfgCopy.URLs = nil
+	cfgCopy.OnEvent = c.dispatch
+	client, err := NewClientFromConfig(&cfgCopy)
+	if err != nil {
+		return nil, err
+	}
+	c.client = client
+	return c, nil
+}
+
+// Subscribe executes an operation on the connection.
+func (c *GraphQLConnection) Subscribe(
+	ctx context.Context,
+	req *GraphQLRequest,
+) (*GraphQLSubscription, error) {
+	c.mutex.Lock()
+	if c.closed {
+		c.mutex.Unlock()
+		return nil, errConnectionClosedByClient
+	}
+	c.nextID++
+	var (
+		id          = strconv.Itoa(c.nextID)
+		resultsChan = make(chan *GraphQLResult)
+		s           = &GraphQLSubscription{
+			ID:          id,
+			Results:     resultsChan,
+			conn:        c,
+			resultsChan: resultsChan,
+			doneChan:    make(chan any),
+		}
+	)
+	c.subscriptions[id] = s
+	c.mutex.Unlock()
+	reqCopy := *req
+	reqCopy.Extensions = map[string]any{"operationId": id}
+	for k, v := range req.Extensions {
+		reqCopy.Extensions[k] = v
+	}
+	if _, err := c.do(ctx, http.MethodPost, c.url, &reqCopy, http.StatusAccepted); err != nil {
+		c.remove(id)
+		s.close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Close disconnects from the server and closes the Results channel of every
+// operation that has not completed.
+func (c *GraphQLConnection) Close() {
+	c.client.Close()
+	c.mutex.Lock()
+	c.closed = true
+	subscriptions := c.subscriptions
+	c.subscriptions = nil
+	c.mutex.Unlock()
+	for _, s := range subscriptions {
+		s.close()
+	}
+}
@@ -0,0 +1,134 @@
+package sse
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewGraphQLClient(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			req := &GraphQLRequest{}
+			if err := json.NewDecoder(r.Body).Decode(req); err != nil ||
+				r.Method != http.MethodPost {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			fmt.Fprintf(w, "event:next\ndata:{\"data\":{\"q\":%q}}\n\n", req.Query)
+			w.Write([]byte("event:complete\ndata\n\n"))
+		},
+	))
+	defer s.Close()
+	c, err := NewGraphQLClient(s.URL, &GraphQLRequest{Query: "{ q }"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	var events []*Event
+	for e := range c.Events {
+		events = append(events, e)
+	}
+	if len(events) != 2 {
+		t.Fatalf("%#v != %#v", len(events), 2)
+	}
+	r, err := DecodeGraphQLResult(events[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := `{"q":"{ q }"}`; string(r.Data) != v {
+		t.Fatalf("%#v != %#v", string(r.Data), v)
+	}
+	if _, err := DecodeGraphQLResult(events[1]); err == nil {
+		t.Fatal("expected error decoding complete event")
+	}
+}
+
+func TestGraphQLConnection(t *testing.T) {
+	var (
+		streamChan = make(chan string)
+		deleted    = make(chan string, 1)
+	)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodPut {
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("token"))
+				return
+			}
+			if r.Header.Get(graphQLTokenHeader) != "token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			switch r.Method {
+			case http.MethodGet:
+				w.(http.Flusher).Flush()
+				for {
+					select {
+					case v := <-streamChan:
+						w.Write([]byte(v))
+						w.(http.Flusher).Flush()
+					case <-r.Context().Done():
+						return
+					}
+				}
+			case http.MethodPost:
+				req := &GraphQLRequest{}
+				json.NewDecoder(r.Body).Decode(req)
+				id := req.Extensions["operationId"]
+				w.WriteHeader(http.StatusAccepted)
+				go func() {
+					streamChan <- fmt.Sprintf(
+						"event:next\ndata:{\"id\":%q,\"payload\":{\"data\":1}}\n\n", id)
+					if req.Query == "complete" {
+						streamChan <- fmt.Sprintf("event:complete\ndata:{\"id\":%q}\n\n", id)
+					}
+				}()
+			case http.MethodDelete:
+				deleted <- r.URL.Query().Get("operationId")
+			}
+		},
+	))
+	defer s.Close()
+	c, err := NewGraphQLConnection(context.Background(), s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	s1, err := c.Subscribe(context.Background(), &GraphQLRequest{Query: "complete"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c.Subscribe(context.Background(), &GraphQLRequest{Query: "open"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	numResults := 0
+	for range s1.Results {
+		numResults += 1
+	}
+	if numResults != 1 {
+		t.Fatalf("%#v != %#v", numResults, 1)
+	}
+	select {
+	case r := <-s2.Results:
+		if string(r.Data) != "1" {
+			t.Fatalf("%#v != %#v", string(r.Data), "1")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for result")
+	}
+	if err := s2.Cancel(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if v := <-deleted; v != s2.ID {
+		t.Fatalf("%#v != %#v", v, s2.ID)
+	}
+	if _, ok := <-s2.Results; ok {
+		t.Fatal("results channel not closed")
+	}
+}
@@ -1,37 +1,489 @@
 package sse
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var (
+	errFlushNotSupported    = errors.New("http.ResponseWriter does not support flushing")
+	errConnectionTerminated = errors.New("connection terminated")
+)
+
+// SlowClientPolicy determines what happens when an event is sent to a client
+// whose buffer is full.
+type SlowClientPolicy int
+
+const (
+
+	// SlowClientDisconnect closes the client's connection.
+	SlowClientDisconnect SlowClientPolicy = iota
+
+	// SlowClientDropOldest discards the oldest buffered event to make room
+	// for the new one.
+	SlowClientDropOldest
+
+	// SlowClientBlock queues events beyond the capacity of the buffer as
+	// long as the client has made room in it within SlowClientTimeout,
+	// closing the client's connection otherwise. Sends do not wait for the
+	// client.
+	SlowClientBlock
+)
+
+// MemoryBudgetPolicy determines what happens when an event is sent to a client
+// while the events queued for all clients exceed MaxBufferedBytes.
+type MemoryBudgetPolicy int
+
+const (
+
+	// MemoryBudgetDropNewest discards the event for the client, which is
+	// later sent an event with the type EventsDroppedEventType containing
+	// the number of events it missed so that it can resynchronize.
+	MemoryBudgetDropNewest MemoryBudgetPolicy = iota
+
+	// MemoryBudgetDisconnect closes the client's connection so that it
+	// reconnects and receives the missed events through replay.
+	MemoryBudgetDisconnect
+)
+
+// UnknownEventIDPolicy determines what happens when a client reconnects with
+// a Last-Event-ID that is not in the event store, such as when the event has
+// been trimmed.
+type UnknownEventIDPolicy int
+
+const (
+
+	// UnknownEventIDReplayAll replays all of the stored events.
+	UnknownEventIDReplayAll UnknownEventIDPolicy = iota
+
+	// UnknownEventIDReplayNone replays nothing; the client only receives new
+	// events.
+	UnknownEventIDReplayNone
+
+	// UnknownEventIDResync sends an event with the type
+	// ResyncRequiredEventType so that the client can fetch a full snapshot out
+	// of band. Its ID is that of the latest event in the stream, allowing the
+	// client to resume from there.
+	UnknownEventIDResync
+)
+
+// HTTPError can be returned by AuthFn or AcceptFn to reject a connection with a
+// specific status code.
+type HTTPError struct {
+
+	// StatusCode is the status code sent in the response.
+	StatusCode int
+
+	// Message is sent as the body of the response. If empty, the status text
+	// is used instead.
+	Message string
+
+	// Header contains additional headers to send in the response, such as
+	// Retry-After or WWW-Authenticate.
+	Header http.Header
+}
+
+func (h *HTTPError) Error() string {
+	if h.Message != "" {
+		return h.Message
+	}
+	return http.StatusText(h.StatusCode)
+}
+
 // HandlerConfig provides a means of passing configuration to NewHandler.
 type HandlerConfig struct {
 
+	// Broker, if provided, is used for distributing and storing events in
+	// place of a Broker created from the options in this struct, allowing
+	// several Handlers to share events and connection limits. The options
+	// marked as broker options are ignored if it is provided.
+	Broker *Broker
+
 	// NumEventsToKeep indicates the number of events that should be kept for
-	// clients reconnecting.
+	// clients reconnecting. If zero and either MaxEventAge or MaxEventBytes is
+	// set, the number of events is not limited. It is ignored if EventStore
+	// is provided. This is a broker option.
 	NumEventsToKeep int
 
+	// DisableReplay prevents events from being stored and causes the
+	// Last-Event-ID of reconnecting clients to be ignored. This is useful for
+	// streams of ephemeral data where replaying events is pointless. This is a
+	// broker option.
+	DisableReplay bool
+
+	// StreamKeyFn, if provided, is invoked when a client connects and returns
+	// the key of the stream the client is attached to, such as a tenant or
+	// room ID taken from the path. Each stream has its own set of clients and
+	// stored events. Events sent without SendToStream are delivered to the
+	// stream with an empty key.
+	StreamKeyFn func(*http.Request) string
+
+	// StreamQueryParam, if provided and StreamKeyFn is not, is the name of a
+	// query parameter that clients use to select the stream they are attached
+	// to.
+	StreamQueryParam string
+
+	// AckKeyFn, if provided, identifies the client making a request so that
+	// it can acknowledge events using AckHandler. An empty return value
+	// indicates that the client cannot acknowledge events.
+	AckKeyFn func(*http.Request) string
+
+	// AckCursorTTL indicates how long the acknowledgment cursor of a client
+	// is kept after it last acknowledged an event or resumed from the cursor.
+	// The default value is 24 hours.
+	AckCursorTTL time.Duration
+
+	// StreamEventStoreFn, if provided, creates the EventStore for each stream
+	// with a non-empty key. By default, a MemoryEventStore with the limits
+	// specified above is used. This is a broker option.
+	StreamEventStoreFn func(string) EventStore
+
+	// NumShards, if greater than one, partitions the clients of each stream
+	// into the specified number of shards and delivers events to the shards
+	// in parallel, allowing sends to scale across cores when there are many
+	// clients. Events are delivered without holding the broker's lock, so
+	// callbacks such as ConflationKeyFn and LaggedFn may run concurrently
+	// regardless of this option. This is a broker option.
+	NumShards int
+
+	// IDGenerator, if provided, is used to assign IDs to events sent without
+	// one. NewCounterIDGenerator, NewTimestampIDGenerator, and
+	// UUIDIDGenerator provide common strategies. This is a broker option.
+	IDGenerator func() string
+
+	// StreamIDGeneratorFn, if provided, creates an ID generator for each
+	// stream (including the one with an empty key) that is used in place of
+	// IDGenerator, giving each stream its own ID namespace. For example, it
+	// can return NewCounterIDGenerator(0) for independent sequences. This is
+	// a broker option.
+	StreamIDGeneratorFn func(string) func() string
+
+	// EnableSequence assigns each event a number from a single sequence that
+	// increases by one with every event sent, even when Send is called from
+	// many goroutines. It is sent to clients in a "seq" field and clients
+	// receive events in sequence order, including across the boundary
+	// between replayed and live events. This is a broker option.
+	EnableSequence bool
+
+	// SuppressDuplicates causes an event to be skipped if it is identical to
+	// the previous event sent to the same stream and topic, which is useful
+	// for sources that republish unchanged state on a timer. Events are
+	// compared before an ID is generated for them. Events sent to specific
+	// clients are never suppressed. This is a broker option.
+	SuppressDuplicates bool
+
+	// DuplicateKeyFn, if provided, is used by SuppressDuplicates to compare
+	// events by the key it returns instead of their byte representation.
+	// This is a broker option.
+	DuplicateKeyFn func(*Event) string
+
+	// LastValueKeyFn, if provided, enables a cache of the most recent event
+	// for each key it returns, such as the event's type or the ID of the
+	// record it updates. The cached events are sent to every client that
+	// connects (after any replayed events) so that state-style streams can
+	// deliver the current state up front. Events for which it returns an
+	// empty string are not cached. This is a broker option.
+	LastValueKeyFn func(*Event) string
+
+	// MaxEventAge, if nonzero, indicates how long events should be kept for
+	// clients reconnecting. It is ignored if EventStore is provided. This is
+	// a broker option.
+	MaxEventAge time.Duration
+
+	// MaxEventBytes, if nonzero, limits the total encoded size of the events
+	// kept for clients reconnecting. It is ignored if EventStore is provided.
+	// This is a broker option.
+	MaxEventBytes int
+
+	// EventStore, if provided, is used for storing events that are replayed
+	// to clients reconnecting. By default, a MemoryEventStore is used. This is
+	// a broker option.
+	EventStore EventStore
+
 	// ChannelBufferSize indicates how many events should be buffered before
-	// the connection is assumed to be dead.
+	// the connection is assumed to be dead. Values less than one are treated
+	// as one.
 	ChannelBufferSize int
 
+	// ConflationKeyFn, if provided, returns a key for each event such as the
+	// ID of the record it updates. When an event is queued for a client
+	// whose buffer already contains an event with the same key, the older
+	// event is discarded, as are all but the newest event for each key among
+	// those replayed to a reconnecting client. Events for which it returns an
+	// empty string are never conflated. It must be safe for concurrent use.
+	ConflationKeyFn func(*Event) string
+
+	// SlowClientPolicy determines what happens when a client's buffer is
+	// full. The default is to disconnect the client.
+	SlowClientPolicy SlowClientPolicy
+
+	// SlowClientTimeout indicates how long a client's buffer may remain full
+	// while events are waiting to be added to it when SlowClientPolicy is
+	// set to SlowClientBlock. The events waiting are only limited by
+	// MaxBufferedBytes.
+	SlowClientTimeout time.Duration
+
+	// MaxBufferedBytes, if nonzero, limits the total size of the events
+	// queued for all of the Handler's clients. Once the limit is reached,
+	// MemoryBudgetPolicy determines what happens to further events.
+	MaxBufferedBytes int
+
+	// MemoryBudgetPolicy determines what happens when an event is sent to a
+	// client while MaxBufferedBytes is exceeded. The default is to discard
+	// the event and notify the client.
+	MemoryBudgetPolicy MemoryBudgetPolicy
+
+	// AuthFn, if provided, is invoked before anything else when a client
+	// connects and may reject the connection by returning an error, in which
+	// case the error is sent as the response. If the error is an *HTTPError,
+	// its status code and headers are used; otherwise the status code is 401.
+	// The returned value can be retrieved from the request's context with
+	// AuthValue and is associated with the client if neither ConnectedFn nor
+	// AcceptFn is provided.
+	AuthFn func(*http.Request) (any, error)
+
 	// ConnectedFn, if provided, is invoked when a client connects. The return
 	// value of this function is associated with the client and is passed to
-	// InitFn and FilterFn.
+	// InitFn and FilterFn. If the value is comparable, it is also used as the
+	// client's key for SendTo and SendToAllExcept. If the value implements
+	// Subscriber, the client is subscribed to the topics it returns. The ID
+	// of the connection can be obtained with ConnectionID so that it can be
+	// included in the value for logging or passed to SendToConnection.
 	ConnectedFn func(*http.Request) any
 
+	// AcceptFn, if provided, is used in place of ConnectedFn and may reject
+	// the connection by returning an error, in which case the error is sent
+	// as the response before any headers are written. If the error is an
+	// *HTTPError, its status code and headers are used; otherwise the status
+	// code is 403.
+	AcceptFn func(*http.Request) (any, error)
+
 	// InitFn, if provided, is invoked right before a client enters the event
 	// loop and sends any events that it returns to the client. This is useful,
 	// for example, if you are synchronizing application state. The single
 	// parameter is equal to the value returned by ConnectedFn.
 	InitFn func(any) []*Event
 
+	// InitStreamFn, if provided, is invoked after InitFn and may write any
+	// number of events to the client using the provided EventWriter, which is
+	// useful for streaming a large snapshot. The second parameter is equal to
+	// the value returned by ConnectedFn. Returning an error closes the
+	// connection. Events sent while InitStreamFn is running are held and
+	// written once it returns; they are not limited by ChannelBufferSize
+	// (though MaxBufferedBytes still applies) and the client is not treated
+	// as slow until the events held beyond ChannelBufferSize have been
+	// written.
+	InitStreamFn func(*http.Request, any, *EventWriter) error
+
+	// MaxConnections, if nonzero, limits the total number of connected
+	// clients. Additional clients receive a 429 response. In-process
+	// subscribers created by Subscribe are not counted.
+	MaxConnections int
+
+	// MaxConnectionsPerIP, if nonzero, limits the number of clients connected
+	// from a single IP address. Additional clients receive a 429 response.
+	MaxConnectionsPerIP int
+
+	// ConnectionLimitRetryAfter is sent in the Retry-After header when a
+	// connection limit is exceeded. If zero, one second is used.
+	ConnectionLimitRetryAfter time.Duration
+
+	// LastEventIDQueryParam, if provided, is the name of a query parameter
+	// that clients may use to indicate the ID of the last event received when
+	// they are unable to set the Last-Event-ID header. The header takes
+	// precedence if both are present.
+	LastEventIDQueryParam string
+
+	// UnknownEventIDPolicy determines what is sent to a client that
+	// reconnects with an ID that is not in the event store. The default is
+	// to replay all stored events.
+	UnknownEventIDPolicy UnknownEventIDPolicy
+
+	// BackfillFn, if provided, is invoked when a client reconnects with an ID
+	// that is not in the event store, typically because the event has been
+	// trimmed. It returns the events after the one with the provided ID that
+	// are older than those in the store, such as from a database; they are
+	// sent followed by all of the stored events. The second parameter is the
+	// value returned by ConnectedFn. If an error is returned,
+	// UnknownEventIDPolicy is applied instead.
+	BackfillFn func(string, any) ([]*Event, error)
+
+	// ResumeTokenKey, if provided, replaces the ID of each event sent to
+	// clients with a resume token containing the ID and an HMAC-SHA256
+	// signature created with the key. A Last-Event-ID that is not a valid
+	// token results in a 400 response, preventing clients from requesting
+	// replay from IDs they invent.
+	ResumeTokenKey []byte
+
+	// ResumeTokenBindFn, if provided, returns a value identifying the client
+	// (such as a user ID) that is included in the signature of resume
+	// tokens, causing tokens issued to one client to be rejected for others.
+	ResumeTokenBindFn func(*http.Request) string
+
+	// ReplayCompleteEventType, if provided, is the type of an event that is
+	// sent to reconnecting clients once missed events have been replayed,
+	// indicating that the events that follow are live.
+	ReplayCompleteEventType string
+
+	// TopicQueryParam, if provided, is the name of a query parameter that
+	// clients may use (multiple times) to subscribe to topics.
+	TopicQueryParam string
+
+	// SubscribeFn, if provided, is invoked when a client connects and returns
+	// the topics that the client should be subscribed to, in addition to any
+	// provided by TopicQueryParam. The second parameter is equal to the value
+	// returned by ConnectedFn.
+	SubscribeFn func(*http.Request, any) []string
+
+	// AudienceFn, if provided, is invoked when a client connects and returns
+	// the audiences that the client is a member of, such as user IDs or
+	// roles. Events with an Audience are only delivered to clients that are
+	// a member of at least one of them. The second parameter is equal to the
+	// value returned by ConnectedFn. It must be safe for concurrent use.
+	AudienceFn func(*http.Request, any) []string
+
 	// FilterFn, if provided, is invoked when an event is being sent to a
 	// client to determine if it should actually be sent. The first parameter
 	// is equal to the value returned by ConnectedFn and the return value
-	// should be set to true to send the event.
+	// should be set to true to send the event. It is invoked concurrently for
+	// different clients and must be safe for concurrent use.
 	FilterFn func(any, *Event) bool
+
+	// DisconnectedFn, if provided, is invoked when a connection ends with
+	// information about the connection and why it ended. NewAccessLogFn
+	// creates a function that writes this information as access log lines.
+	DisconnectedFn func(*DisconnectInfo)
+
+	// LaggedFn, if provided, is invoked in a separate goroutine when a client
+	// starts lagging behind, allowing the application to resynchronize the
+	// client or reduce what it is sent. Lag is checked whenever an event is
+	// queued for the client and LaggedFn is not invoked again until the
+	// client catches up.
+	LaggedFn func(*ConnectionInfo)
+
+	// LagThreshold, if nonzero, is the number of events queued for a client
+	// at which it is considered to be lagging.
+	LagThreshold int
+
+	// LagDuration, if nonzero, is how long a client with events queued may
+	// go without a successful write before it is considered to be lagging.
+	LagDuration time.Duration
+
+	// TransformFn, if provided, is invoked for each event that passes FilterFn
+	// (including events replayed after reconnecting) and returns the event
+	// that should be sent to the client in its place. Returning nil skips the
+	// event. The first parameter is equal to the value returned by
+	// ConnectedFn. The provided event is shared by all clients and must not
+	// be modified in place; to alter it, copy it (c := *e), modify the copy
+	// and return a pointer to the copy. Like FilterFn, it must be safe for
+	// concurrent use.
+	TransformFn func(any, *Event) *Event
+
+	// AllowedOrigins lists the origins permitted to make cross-origin
+	// requests. A value of "*" permits any origin. Preflight requests from
+	// permitted origins are answered automatically.
+	AllowedOrigins []string
+
+	// AllowedHeaders lists request headers, in addition to Last-Event-ID,
+	// that cross-origin clients are permitted to send.
+	AllowedHeaders []string
+
+	// AllowCredentials indicates that cross-origin requests may include
+	// credentials such as cookies.
+	AllowCredentials bool
+
+	// TrustedOrigins, if provided, lists the origins that clients may connect
+	// from. Requests with an Origin header that is not listed, not accepted
+	// by OriginFn, and not the same as the request's host are rejected with a
+	// 403 response. Requests without an Origin header are permitted.
+	TrustedOrigins []string
+
+	// OriginFn, if provided, is invoked to validate the Origin header of
+	// requests whose origin is not in TrustedOrigins. Setting it enables
+	// validation even if TrustedOrigins is empty.
+	OriginFn func(string) bool
+
+	// HeartbeatInterval, if nonzero, causes an event of type
+	// HeartbeatEventType to be sent to each client at the specified interval.
+	// The data is a JSON-encoded Heartbeat containing the server's time and
+	// the ID of the latest event sent to the client's stream.
+	HeartbeatInterval time.Duration
+
+	// MaxConnectionDuration, if nonzero, limits how long a client may remain
+	// connected before the stream is closed, forcing the client to reconnect.
+	// This prevents clients from being pinned to a single server.
+	MaxConnectionDuration time.Duration
+
+	// ReconnectDelay, if nonzero, is sent to clients as the reconnection time
+	// when the Handler ends a stream so that the client reconnects (due to
+	// MaxConnectionDuration or Drain). A large value can be used to spread
+	// out reconnects during a deploy.
+	ReconnectDelay time.Duration
+
+	// ClientRetry, if nonzero, is sent to every client as the reconnection
+	// time when it connects, allowing reconnect pacing to be controlled
+	// centrally instead of relying on each client's default.
+	ClientRetry time.Duration
+
+	// FlushInterval, if nonzero, delays flushing after an event is written
+	// by up to the specified duration so that bursts of events are sent to
+	// the client together, trading latency for throughput.
+	FlushInterval time.Duration
+
+	// WriteTimeout, if nonzero, limits how long writing a single event to a
+	// client may take before the client is assumed to be stuck and is
+	// disconnected.
+	WriteTimeout time.Duration
+
+	// EnableCompression indicates that the event stream should be compressed
+	// with gzip for clients that accept it. The compressor is flushed after
+	// each event.
+	EnableCompression bool
+
+	// Header, if provided, contains additional headers to include in the
+	// response, such as "X-Accel-Buffering: no" for clients behind nginx.
+	// Values replace the default Cache-Control and Content-Type headers if
+	// those are specified.
+	Header http.Header
+
+	// StatusCode, if nonzero, is used in place of 200 for the response.
+	StatusCode int
+
+	// HelloComment, if provided, is written as a comment (such as "ok")
+	// immediately after the headers so that clients and intermediaries see
+	// that the stream is established before the first event is sent. The
+	// headers are flushed immediately either way.
+	HelloComment string
+
+	// InitialPadding, if nonzero, is the number of bytes of comment padding
+	// written and flushed as soon as a client connects. Some older polyfills
+	// and buffering proxies do not deliver anything until roughly 2KB have
+	// been received.
+	InitialPadding int
+
+	// EventPadding, if nonzero, is the number of bytes of comment padding
+	// written after each event.
+	EventPadding int
+
+	// DrainEvent, if provided, is sent to each client right before its
+	// connection is closed by Drain.
+	DrainEvent *Event
+
+	// ShutdownEvent, if provided, is sent to each client right before its
+	// connection is closed by ShutdownContext or Close. This can be used to
+	// provide clients with a retry hint, for example.
+	ShutdownEvent *Event
 }
 
 // DefaultHandlerConfig provides a set of defaults.
@@ -40,15 +492,133 @@ var DefaultHandlerConfig = &HandlerConfig{
 	ChannelBufferSize: 4,
 }
 
+// ConnectionInfo provides information about an active client connection.
+type ConnectionInfo struct {
+
+	// ID uniquely identifies the connection for the lifetime of the Broker.
+	// It is also available to callbacks through ConnectionID.
+	ID uint64
+
+	// RemoteAddr is the network address of the client.
+	RemoteAddr string
+
+	// ConnectedAt indicates when the client connected.
+	ConnectedAt time.Time
+
+	// Value is the value returned by ConnectedFn for the client.
+	Value any
+
+	// Lag is the number of events queued for the client that have not yet
+	// been written.
+	Lag int
+
+	// Dropped is the number of events discarded for the client by
+	// SlowClientDropOldest or evicted to make room for a critical event.
+	Dropped uint64
+
+	// Conflated is the number of events replaced by a newer event with the
+	// same key returned by ConflationKeyFn.
+	Conflated uint64
+
+	// LastWriteAt indicates when an event was last written to the client.
+	LastWriteAt time.Time
+}
+
+// DisconnectReason indicates why a connection ended.
+type DisconnectReason int
+
+const (
+
+	// DisconnectServerClosed indicates that the Handler was closed.
+	DisconnectServerClosed DisconnectReason = iota
+
+	// DisconnectClientClosed indicates that the client closed the connection.
+	DisconnectClientClosed
+
+	// DisconnectSlowClient indicates that the client's buffer was full.
+	DisconnectSlowClient
+
+	// DisconnectKicked indicates that the connection was closed by a call to
+	// Disconnect.
+	DisconnectKicked
+
+	// DisconnectWriteFailed indicates that writing to the client failed or
+	// did not complete within WriteTimeout.
+	DisconnectWriteFailed
+
+	// DisconnectMaxDuration indicates that the connection was open for
+	// MaxConnectionDuration.
+	DisconnectMaxDuration
+
+	// DisconnectDrained indicates that the connection was closed by Drain.
+	DisconnectDrained
+
+	// DisconnectInitFailed indicates that InitStreamFn returned an error.
+	DisconnectInitFailed
+)
+
+// DisconnectInfo provides information about a connection that has ended.
+type DisconnectInfo struct {
+	ConnectionInfo
+
+	// Duration indicates how long the client was connected.
+	Duration time.Duration
+
+	// EventsSent indicates the number of events written to the client.
+	EventsSent int
+
+	// BytesWritten indicates the number of bytes written to the response
+	// body (after compression, if enabled).
+	BytesWritten int64
+
+	// Reason indicates why the connection ended.
+	Reason DisconnectReason
+}
+
+// Subscriber can be implemented by the value returned by ConnectedFn to
+// subscribe the client to a set of topics. Events sent to a topic are routed
+// to subscribed clients using an index, which is far cheaper than checking
+// each event against each client with FilterFn.
+type Subscriber interface {
+	Topics() []string
+}
+
+// EventWriter writes events directly to a single client.
+type EventWriter struct {
+	writeFn func(*Event) error
+	flushFn func() error
+}
+
+// Write writes the event to the client. The event is not passed to FilterFn
+// or TransformFn.
+func (w *EventWriter) Write(e *Event) error {
+	return w.writeFn(e)
+}
+
+// Flush sends any buffered events to the client.
+func (w *EventWriter) Flush() error {
+	return w.flushFn()
+}
+
 // Handler provides an http.Handler that can be used for sending events to any
-// number of connected clients.
+// number of connected clients. Events are distributed by the Handler's
+// Broker, whose methods (such as Send) can be called on the Handler directly.
 type Handler struct {
-	mutex      sync.Mutex
+	*Broker
 	waitGroup  sync.WaitGroup
 	cfg        *HandlerConfig
-	eventQueue []*Event
-	eventChans map[chan *Event]any
+	serving    connSet
+	cursors    map[cursorKey]*cursor
+	lastSweep  time.Time
+	sources    map[*Source]struct{}
+	budget     *memoryBudget
+	isDraining bool
 	isClosed   bool
+
+	// runtime contains the settings that can be changed by Reconfigure,
+	// which closes and replaces reconfigChan to notify connections
+	runtime      *RuntimeConfig
+	reconfigChan chan struct{}
 }
 
 // NewHandler creates a new Handler instance.
@@ -56,29 +626,367 @@ func NewHandler(cfg *HandlerConfig) *Handler {
 	if cfg == nil {
 		cfg = DefaultHandlerConfig
 	}
-	return &Handler{
-		cfg:        cfg,
-		eventChans: make(map[chan *Event]any),
+	b := cfg.Broker
+	if b == nil {
+		b = NewBroker(&BrokerConfig{
+			NumEventsToKeep:     cfg.NumEventsToKeep,
+			MaxEventAge:         cfg.MaxEventAge,
+			MaxEventBytes:       cfg.MaxEventBytes,
+			DisableReplay:       cfg.DisableReplay,
+			EventStore:          cfg.EventStore,
+			StreamEventStoreFn:  cfg.StreamEventStoreFn,
+			NumShards:           cfg.NumShards,
+			IDGenerator:         cfg.IDGenerator,
+			StreamIDGeneratorFn: cfg.StreamIDGeneratorFn,
+			EnableSequence:      cfg.EnableSequence,
+			SuppressDuplicates:  cfg.SuppressDuplicates,
+			DuplicateKeyFn:      cfg.DuplicateKeyFn,
+			LastValueKeyFn:      cfg.LastValueKeyFn,
+
+			// Subscribers use the same buffer size as clients
+			SubscriberBufferSize: cfg.ChannelBufferSize,
+		})
+	}
+	h := &Handler{
+		Broker:  b,
+		cfg:     cfg,
+		serving: make(connSet),
+		cursors: make(map[cursorKey]*cursor),
+		sources: make(map[*Source]struct{}),
+		runtime: &RuntimeConfig{
+			HeartbeatInterval:   cfg.HeartbeatInterval,
+			MaxConnections:      cfg.MaxConnections,
+			MaxConnectionsPerIP: cfg.MaxConnectionsPerIP,
+		},
+		reconfigChan: make(chan struct{}),
+	}
+	if cfg.MaxBufferedBytes != 0 {
+		h.budget = &memoryBudget{limit: int64(cfg.MaxBufferedBytes)}
 	}
+	return h
 }
 
-func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+// checkLimits returns an error if accepting the connection would exceed a
+// connection limit. The mutex must be held when calling this method.
+func (h *Handler) checkLimits(conn *connection) error {
+	if (h.runtime.MaxConnections != 0 &&
+		len(h.conns)-h.numSubs >= h.runtime.MaxConnections) ||
+		(h.runtime.MaxConnectionsPerIP != 0 &&
+			h.ipConns[conn.remoteIP] >= h.runtime.MaxConnectionsPerIP) {
+		retryAfter := h.cfg.ConnectionLimitRetryAfter
+		if retryAfter == 0 {
+			retryAfter = time.Second
+		}
+		return &HTTPError{
+			StatusCode: http.StatusTooManyRequests,
+			Header: http.Header{
+				"Retry-After": []string{
+					strconv.Itoa(int((retryAfter + time.Second - 1) / time.Second)),
+				},
+			},
+		}
+	}
+	return nil
+}
 
-	// Determine if there is a value to associate with this client
+// streamFor returns the key of the stream that the request is for.
+func (h *Handler) streamFor(r *http.Request) string {
+	if h.cfg.StreamKeyFn != nil {
+		return h.cfg.StreamKeyFn(r)
+	}
+	if h.cfg.StreamQueryParam != "" {
+		return r.URL.Query().Get(h.cfg.StreamQueryParam)
+	}
+	return ""
+}
+
+// conflate removes each event for which there is a later event with the same
+// conflation key that the connection wants.
+func (h *Handler) conflate(conn *connection, events []*Event) []*Event {
+	if h.cfg.ConflationKeyFn == nil {
+		return events
+	}
+	var (
+		seen      = make(map[string]struct{})
+		conflated = make([]*Event, 0, len(events))
+	)
+	for i := len(events) - 1; i >= 0; i-- {
+		if !conn.wants(events[i]) {
+			continue
+		}
+		if key := h.cfg.ConflationKeyFn(events[i]); key != "" {
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+		}
+		conflated = append(conflated, events[i])
+	}
+	for i, j := 0, len(conflated)-1; i < j; i, j = i+1, j-1 {
+		conflated[i], conflated[j] = conflated[j], conflated[i]
+	}
+	return conflated
+}
+
+// newResyncEvent creates an event instructing the client to resynchronize,
+// carrying the ID of the latest event sent to the stream.
+func (h *Handler) newResyncEvent(stream string) *Event {
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	return &Event{
+		Type: ResyncRequiredEventType,
+		ID:   h.lastEventIDs[stream],
+	}
+}
+
+// padding returns a comment line that is n bytes long (at least two), or nil
+// if n is zero.
+func padding(n int) []byte {
+	if n == 0 {
+		return nil
+	}
+	if n < 2 {
+		n = 2
+	}
+	b := bytes.Repeat([]byte{' '}, n)
+	b[0] = ':'
+	b[n-1] = '\r'
+	return b
+}
+
+// canFlush determines if the writer (or any writer it wraps) implements
+// http.Flusher, mirroring the unwrapping done by http.ResponseController.
+func canFlush(w http.ResponseWriter) bool {
+	for {
+		switch t := w.(type) {
+		case http.Flusher:
+			return true
+		case interface{ Unwrap() http.ResponseWriter }:
+			w = t.Unwrap()
+		default:
+			return false
+		}
+	}
+}
+
+type authValueKey struct{}
+
+// AuthValue returns the value returned by AuthFn for the request with the
+// provided context or nil if there is none.
+func AuthValue(ctx context.Context) any {
+	return ctx.Value(authValueKey{})
+}
+
+type connIDKey struct{}
+
+// ConnectionID returns the ID of the connection for the request with the
+// provided context or zero if there is none. The ID is the same one reported
+// in ConnectionInfo and accepted by Disconnect and SendToConnection, allowing
+// ConnectedFn to include it in the value associated with the client.
+func ConnectionID(ctx context.Context) uint64 {
+	id, _ := ctx.Value(connIDKey{}).(uint64)
+	return id
+}
+
+// remoteIP returns the IP address of the client without the port.
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// acceptsGzip determines if the client accepts gzip-encoded responses.
+func acceptsGzip(r *http.Request) bool {
+	for _, h := range r.Header.Values("Accept-Encoding") {
+		for _, v := range strings.Split(h, ",") {
+			parts := strings.Split(v, ";")
+			if strings.TrimSpace(parts[0]) != "gzip" {
+				continue
+			}
+			if len(parts) > 1 {
+				if q := strings.TrimSpace(parts[1]); q == "q=0" || q == "q=0.0" {
+					return false
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// writeHTTPError writes the error as a response, using the status code and
+// headers from the error if it is an *HTTPError.
+func writeHTTPError(w http.ResponseWriter, err error, statusCode int) {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		statusCode = httpErr.StatusCode
+		for k, v := range httpErr.Header {
+			w.Header()[k] = v
+		}
+	}
+	http.Error(w, err.Error(), statusCode)
+}
+
+// accept authorizes the client making the request and determines the value
+// associated with it. If the client is rejected, an error is written and
+// false is returned.
+func (h *Handler) accept(w http.ResponseWriter, r *http.Request) (*http.Request, any, bool) {
+
+	// Authorize the client if requested
 	var v any = nil
-	if h.cfg.ConnectedFn != nil {
+	if h.cfg.AuthFn != nil {
+		authValue, err := h.cfg.AuthFn(r)
+		if err != nil {
+			writeHTTPError(w, err, http.StatusUnauthorized)
+			return r, nil, false
+		}
+		r = r.WithContext(context.WithValue(r.Context(), authValueKey{}, authValue))
+		v = authValue
+	}
+
+	// Determine if there is a value to associate with this client
+	if h.cfg.AcceptFn != nil {
+		var err error
+		v, err = h.cfg.AcceptFn(r)
+		if err != nil {
+			writeHTTPError(w, err, http.StatusForbidden)
+			return r, nil, false
+		}
+	} else if h.cfg.ConnectedFn != nil {
 		v = h.cfg.ConnectedFn(r)
 	}
+	return r, v, true
+}
 
-	// We need to be able to flush the writer after each chunk
-	f, ok := w.(http.Flusher)
+// newConnection creates a connection for the client making the request,
+// determining the stream, topics, and audiences it receives events from.
+func (h *Handler) newConnection(r *http.Request, id uint64, v any) *connection {
+	conn := &connection{
+		id:          id,
+		remoteAddr:  r.RemoteAddr,
+		remoteIP:    remoteIP(r),
+		connectedAt: time.Now(),
+		value:       v,
+		topics:      make(map[string]struct{}),
+		cfg:         h.cfg,
+	}
+	conn.stream = h.streamFor(r)
+	if isComparable(v) {
+		conn.key = v
+	}
+	if h.cfg.TopicQueryParam != "" {
+		for _, t := range r.URL.Query()[h.cfg.TopicQueryParam] {
+			conn.topics[t] = struct{}{}
+		}
+	}
+	if h.cfg.SubscribeFn != nil {
+		for _, t := range h.cfg.SubscribeFn(r, v) {
+			conn.topics[t] = struct{}{}
+		}
+	}
+	if h.cfg.AudienceFn != nil {
+		conn.audiences = make(map[string]struct{})
+		for _, a := range h.cfg.AudienceFn(r, v) {
+			conn.audiences[a] = struct{}{}
+		}
+	}
+	if sub, ok := v.(Subscriber); ok {
+		for _, t := range sub.Topics() {
+			conn.topics[t] = struct{}{}
+		}
+	}
+	return conn
+}
+
+// prepare determines if the event should be sent to the client, returning
+// the event to send or nil.
+func (h *Handler) prepare(conn *connection, e *Event) *Event {
+	if h.cfg.FilterFn != nil && !h.cfg.FilterFn(conn.value, e) {
+		return nil
+	}
+	if h.cfg.TransformFn != nil {
+		t := h.cfg.TransformFn(conn.value, e)
+
+		// A copy of the event made by TransformFn also copies the cached
+		// bytes, which no longer reflect its fields
+		if t != nil && t != e {
+			t.encoded = nil
+		}
+		return t
+	}
+	return e
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+
+	// Reject requests from untrusted origins
+	if !h.trustedOrigin(r) {
+		http.Error(
+			w,
+			http.StatusText(http.StatusForbidden),
+			http.StatusForbidden,
+		)
+		return
+	}
+
+	// Add CORS headers and respond to OPTIONS requests
+	if h.handleCORS(w, r) {
+		return
+	}
+
+	// Assign the connection an ID up front so that it is available to the
+	// callbacks invoked while the connection is being set up
+	id := h.nextConnID()
+	r = r.WithContext(context.WithValue(r.Context(), connIDKey{}, id))
+
+	// Authorize the client and determine which events it receives
+	r, v, ok := h.accept(w, r)
+	if !ok {
+		return
+	}
+	conn := h.newConnection(r, id, v)
+
+	// Determine where to resume from, rejecting forged resume tokens
+	binding := h.resumeBinding(r)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" && h.cfg.LastEventIDQueryParam != "" {
+		lastEventID = r.URL.Query().Get(h.cfg.LastEventIDQueryParam)
+	}
+	lastEventID, ok = h.verifyID(binding, lastEventID)
 	if !ok {
-		panic("http.ResponseWriter does not implement http.Flusher")
+		http.Error(w, errInvalidResumeToken.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// We need to be able to flush the writer after each chunk
+	if !canFlush(w) {
+		http.Error(
+			w,
+			errFlushNotSupported.Error(),
+			http.StatusInternalServerError,
+		)
+		return
 	}
+	rc := http.NewResponseController(w)
 
-	// Register the channel
+	// Allow the connection to be terminated by CloseContext, interrupting
+	// any write that is in progress
+	var (
+		ctx, cancel = context.WithCancel(r.Context())
+		terminated  atomic.Bool
+	)
+	defer cancel()
+	conn.terminate = func() {
+		terminated.Store(true)
+		rc.SetWriteDeadline(time.Now())
+		cancel()
+	}
+
+	// Register the connection
 	h.mutex.Lock()
-	if h.isClosed {
+	if h.isClosed || h.isDraining {
 		h.mutex.Unlock()
 		http.Error(
 			w,
@@ -87,99 +995,498 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		)
 		return
 	}
+	if err := h.checkLimits(conn); err != nil {
+		h.mutex.Unlock()
+		writeHTTPError(w, err, http.StatusTooManyRequests)
+		return
+	}
 	h.waitGroup.Add(1)
 	defer h.waitGroup.Done()
-	eventChan := make(chan *Event, h.cfg.ChannelBufferSize)
-	h.eventChans[eventChan] = nil
+	conn.buffer = newRingBuffer(h.cfg.ChannelBufferSize)
+	conn.buffer.budget = h.budget
+	if h.cfg.InitStreamFn != nil {
+		conn.buffer.hold()
+	}
+	h.addConnection(conn)
+	h.serving[conn] = struct{}{}
+	var (
+		reconfigChan      = h.reconfigChan
+		heartbeatInterval = h.runtime.HeartbeatInterval
+	)
 	h.mutex.Unlock()
+	defer func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		delete(h.serving, conn)
+	}()
+
+	// Release any events that will not be written so that SendContext does
+	// not wait for them; the connection is no longer registered at this point
+	defer func() {
+		for {
+			e, _ := conn.buffer.pop()
+			if e == nil {
+				return
+			}
+			e.markWritten()
+		}
+	}()
+
+	// Keep track of the events written for DisconnectedFn; once a write
+	// fails, all further writes are skipped and the error is retained
+	var (
+		counter              = &countingWriter{w: w}
+		out        io.Writer = counter
+		gz         *gzip.Writer
+		eventsSent int
+		writeErr   error
+	)
+	setDeadline := func() {
+		if h.cfg.WriteTimeout != 0 {
+			rc.SetWriteDeadline(time.Now().Add(h.cfg.WriteTimeout))
+		}
+	}
+	eventPadding := padding(h.cfg.EventPadding)
+	write := func(e *Event) {
+		if writeErr == nil && terminated.Load() {
+			writeErr = errConnectionTerminated
+		}
+		if writeErr != nil {
+			return
+		}
+		if h.cfg.ResumeTokenKey != nil && e.ID != "" {
+			eCopy := *e
+			eCopy.ID = h.signID(binding, e.ID)
+			eCopy.encoded = nil
+			e = &eCopy
+		}
+		setDeadline()
+		if _, writeErr = e.WriteTo(out); writeErr == nil {
+			eventsSent++
+			conn.lastWrite.Store(time.Now().UnixNano())
+			if eventPadding != nil {
+				_, writeErr = out.Write(eventPadding)
+			}
+		}
+	}
+
+	// writeRetry sends a reconnection time without dispatching an event
+	writeRetry := func(d time.Duration) {
+		if writeErr != nil || d == 0 {
+			return
+		}
+		setDeadline()
+		_, writeErr = fmt.Fprintf(out, "retry:%d\r\r", d.Milliseconds())
+	}
+	flush := func() bool {
+		if writeErr == nil && gz != nil {
+			writeErr = gz.Flush()
+		}
+		if writeErr == nil {
+			writeErr = rc.Flush()
+		}
+		if writeErr != nil {
+			h.mutex.Lock()
+			h.dropConnection(conn, DisconnectWriteFailed)
+			h.mutex.Unlock()
+			return false
+		}
+		return true
+	}
+	if h.cfg.DisconnectedFn != nil {
+		defer func() {
+			h.mutex.Lock()
+			reason := conn.reason
+			h.mutex.Unlock()
+			h.cfg.DisconnectedFn(&DisconnectInfo{
+				ConnectionInfo: *conn.info(),
+				Duration:       time.Since(conn.connectedAt),
+				EventsSent:     eventsSent,
+				BytesWritten:   counter.n,
+				Reason:         reason,
+			})
+		}()
+	}
 
 	// Write the response headers
 	w.Header().Set("Cache-Control", "no-store")
 	w.Header().Set("Content-Type", "text/event-stream")
-	w.WriteHeader(http.StatusOK)
+	if h.cfg.EnableCompression {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if acceptsGzip(r) {
+			w.Header().Set("Content-Encoding", "gzip")
+			gz = gzip.NewWriter(counter)
+			out = gz
+			defer gz.Close()
+		}
+	}
+	for k, v := range h.cfg.Header {
+		w.Header()[k] = append([]string(nil), v...)
+	}
+	statusCode := h.cfg.StatusCode
+	if statusCode == 0 {
+		statusCode = http.StatusOK
+	}
+	w.WriteHeader(statusCode)
+
+	// Write the initial padding, reconnection time, and hello comment (if
+	// requested) and flush the headers so that the client sees the stream
+	// established right away
+	if h.cfg.InitialPadding != 0 {
+		setDeadline()
+		_, writeErr = out.Write(padding(h.cfg.InitialPadding))
+	}
+	writeRetry(h.cfg.ClientRetry)
+	if h.cfg.HelloComment != "" && writeErr == nil {
+		setDeadline()
+		_, writeErr = io.WriteString(out, ":"+h.cfg.HelloComment+"\r")
+	}
+	if !flush() {
+		return
+	}
 
 	// Make a list of events to send on intialization if requested
-	lastEventID := r.Header.Get("Last-Event-ID")
+	if id := h.ackCursor(conn.stream, r); id != "" {
+		lastEventID = id
+	}
+	var (
+		replayed     = make(map[string]struct{})
+		lastSequence uint64
+	)
 	if lastEventID != "" {
-		events := []*Event{}
-		func() {
-			defer h.mutex.Unlock()
-			h.mutex.Lock()
-			lastEventIdx := -1
-			for i, e := range h.eventQueue {
-				if lastEventID == e.ID {
-					lastEventIdx = i
+		events, ok := h.replay(conn.stream, lastEventID)
+		if !ok && h.cfg.BackfillFn != nil {
+			backfill, err := h.cfg.BackfillFn(lastEventID, v)
+			if err == nil {
+				for _, e := range backfill {
+					if e = h.prepare(conn, e); e != nil {
+						write(e)
+					}
 				}
+				events, ok = h.replay(conn.stream, "")
 			}
-			events = append(events, h.eventQueue[lastEventIdx+1:]...)
-		}()
-		for _, e := range events {
-			if h.cfg.FilterFn == nil || h.cfg.FilterFn(v, e) {
-				w.Write(e.Bytes())
+		}
+		if !ok {
+			switch h.cfg.UnknownEventIDPolicy {
+			case UnknownEventIDReplayAll:
+				events, _ = h.replay(conn.stream, "")
+			case UnknownEventIDResync:
+				write(h.newResyncEvent(conn.stream))
+			}
+		}
+		for _, e := range h.conflate(conn, events) {
+			if !conn.wants(e) {
+				continue
+			}
+			if e.ID != "" {
+				replayed[e.ID] = struct{}{}
+			}
+			if e.Sequence > lastSequence {
+				lastSequence = e.Sequence
 			}
+			if e = h.prepare(conn, e); e != nil {
+				write(e)
+			}
+		}
+	}
+
+	// Send the latest value of each key unless it was just replayed
+	for _, e := range h.lastValuesFor(conn.stream) {
+		if _, ok := replayed[e.ID]; ok || !conn.wants(e) {
+			continue
+		}
+		if e = h.prepare(conn, e); e != nil {
+			write(e)
 		}
-		f.Flush()
+	}
+	if lastEventID != "" && h.cfg.ReplayCompleteEventType != "" {
+		write(&Event{Type: h.cfg.ReplayCompleteEventType})
+	}
+	if !flush() {
+		return
 	}
 
 	// Send messages received from InitFn (if provided)
 	if h.cfg.InitFn != nil {
 		for _, e := range h.cfg.InitFn(v) {
-			w.Write(e.Bytes())
+			write(e)
+		}
+		if !flush() {
+			return
+		}
+	}
+
+	// Stream events from InitStreamFn (if provided)
+	if h.cfg.InitStreamFn != nil {
+		ew := &EventWriter{
+			writeFn: func(e *Event) error {
+				write(e)
+				return writeErr
+			},
+			flushFn: func() error {
+				flush()
+				return writeErr
+			},
+		}
+		err := h.cfg.InitStreamFn(r, v, ew)
+		conn.buffer.release()
+		if !flush() {
+			return
+		}
+		if err != nil {
+			func() {
+				defer h.mutex.Unlock()
+				h.mutex.Lock()
+				h.dropConnection(conn, DisconnectInitFailed)
+			}()
+			return
 		}
-		f.Flush()
 	}
 
-	// Write events as they come in
+	// Write events as they come in; if a flush interval is set, events are
+	// marked as written only once they have been flushed
+	var (
+		flushTimer    *time.Timer
+		flushChan     <-chan time.Time
+		unflushed     []*Event
+		durationChan  <-chan time.Time
+		heartbeatChan <-chan time.Time
+	)
+	if h.cfg.MaxConnectionDuration != 0 {
+		durationTimer := time.NewTimer(h.cfg.MaxConnectionDuration)
+		defer durationTimer.Stop()
+		durationChan = durationTimer.C
+	}
+
+	// The heartbeat ticker is replaced if the interval is changed by
+	// Reconfigure
+	var heartbeatTicker *time.Ticker
+	setHeartbeatInterval := func(d time.Duration) {
+		if heartbeatTicker != nil {
+			heartbeatTicker.Stop()
+			heartbeatTicker = nil
+			heartbeatChan = nil
+		}
+		if d != 0 {
+			heartbeatTicker = time.NewTicker(d)
+			heartbeatChan = heartbeatTicker.C
+		}
+	}
+	setHeartbeatInterval(heartbeatInterval)
+	defer setHeartbeatInterval(0)
+	flushUnflushed := func() bool {
+		ok := flush()
+		for _, e := range unflushed {
+			e.markWritten()
+		}
+		unflushed = unflushed[:0]
+		flushChan = nil
+		return ok
+	}
+	defer func() {
+		if flushTimer != nil {
+			flushTimer.Stop()
+		}
+		for _, e := range unflushed {
+			e.markWritten()
+		}
+	}()
 	for {
 		select {
-		case e, ok := <-eventChan:
-			if !ok {
-				// The server is shutting down the connection; no need to
-				// remove ourselves from the map
+		case <-conn.buffer.readyChan:
+			for {
+				e, ok := conn.buffer.pop()
+				if e == nil {
+					if ok {
+						break
+					}
+					// The server is shutting down the connection; no need
+					// to remove ourselves from the map
+					h.mutex.Lock()
+					reason := conn.reason
+					h.mutex.Unlock()
+					switch reason {
+					case DisconnectServerClosed:
+						if h.cfg.ShutdownEvent != nil {
+							write(h.cfg.ShutdownEvent)
+						}
+					case DisconnectDrained:
+						if h.cfg.DrainEvent != nil {
+							write(h.cfg.DrainEvent)
+						}
+						writeRetry(h.cfg.ReconnectDelay)
+					}
+					flushUnflushed()
+					return
+				}
+
+				// Skip events that were sent after the connection was
+				// registered but before the replay and were therefore
+				// already written
+				var p *Event
+				if e.Sequence == 0 || e.Sequence > lastSequence {
+					p = h.prepare(conn, e)
+				}
+				if p != nil {
+					write(p)
+				}
+				if h.cfg.FlushInterval == 0 {
+					ok := true
+					if p != nil {
+						ok = flush()
+					}
+					e.markWritten()
+					if !ok {
+						return
+					}
+					continue
+				}
+				unflushed = append(unflushed, e)
+				if flushChan == nil {
+					if flushTimer == nil {
+						flushTimer = time.NewTimer(h.cfg.FlushInterval)
+					} else {
+						flushTimer.Reset(h.cfg.FlushInterval)
+					}
+					flushChan = flushTimer.C
+				}
+			}
+
+			// Notify the client of any events discarded due to the memory
+			// budget once the queued events have been written
+			if e := conn.shedEvent(); e != nil {
+				write(e)
+				if !flushUnflushed() {
+					return
+				}
+			}
+		case <-flushChan:
+			if !flushUnflushed() {
 				return
 			}
-			if h.cfg.FilterFn == nil || h.cfg.FilterFn(v, e) {
-				w.Write(e.Bytes())
-				f.Flush()
+		case <-reconfigChan:
+			h.mutex.Lock()
+			reconfigChan = h.reconfigChan
+			d := h.runtime.HeartbeatInterval
+			h.mutex.Unlock()
+			if d != heartbeatInterval {
+				heartbeatInterval = d
+				setHeartbeatInterval(d)
+			}
+		case <-heartbeatChan:
+			h.mutex.Lock()
+			lastEventID := h.lastEventIDs[conn.stream]
+			h.mutex.Unlock()
+			write(newHeartbeatEvent(h.signID(binding, lastEventID)))
+			if !flushUnflushed() {
+				return
 			}
-		case <-r.Context().Done():
-			// Client disconnected, remove this channel from the map
+		case <-durationChan:
+			// Ask the client to reconnect (likely to a different server)
+			writeRetry(h.cfg.ReconnectDelay)
+			flushUnflushed()
+			func() {
+				defer h.mutex.Unlock()
+				h.mutex.Lock()
+				h.dropConnection(conn, DisconnectMaxDuration)
+			}()
+			return
+		case <-ctx.Done():
+			// Client disconnected, remove this connection from the map
 			func() {
 				defer h.mutex.Unlock()
 				h.mutex.Lock()
-				delete(h.eventChans, eventChan)
+				h.dropConnection(conn, DisconnectClientClosed)
 			}()
 			return
 		}
 	}
 }
 
-// Send sends the provided event to all connected clients. Any clients that
-// block are forcibly disconnected.
-func (h *Handler) Send(e *Event) {
-	defer h.mutex.Unlock()
+// Drain stops accepting new connections and closes the existing ones,
+// sending DrainEvent and ReconnectDelay to each client if provided. The
+// connections are closed at even intervals over the specified period to
+// avoid all clients reconnecting at once. An error is returned if the
+// context is done before all connections are closed.
+func (h *Handler) Drain(ctx context.Context, period time.Duration) error {
 	h.mutex.Lock()
-	for c := range h.eventChans {
-		select {
-		case c <- e:
-		default:
-			close(c)
-			delete(h.eventChans, c)
-		}
+	h.isDraining = true
+	conns := []*connection{}
+	for conn := range h.serving {
+		conns = append(conns, conn)
 	}
-	h.eventQueue = append(h.eventQueue, e)
-	if len(h.eventQueue) > h.cfg.NumEventsToKeep {
-		h.eventQueue = h.eventQueue[1:]
+	h.mutex.Unlock()
+	var interval time.Duration
+	if len(conns) != 0 {
+		interval = period / time.Duration(len(conns))
 	}
+	for i, conn := range conns {
+		if i != 0 && interval != 0 {
+			select {
+			case <-time.After(interval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		h.mutex.Lock()
+		if _, ok := h.conns[conn]; ok {
+			h.closeConnection(conn, DisconnectDrained)
+		}
+		h.mutex.Unlock()
+	}
+	return nil
 }
 
-// Close shuts down all of the event channels and waits for them to complete.
-func (h *Handler) Close() {
+// ShutdownContext closes all of the Handler's connections and sources,
+// sending ShutdownEvent to each client if provided, and waits for the
+// connections to complete or the context to be done, whichever happens first.
+func (h *Handler) ShutdownContext(ctx context.Context) error {
 	h.mutex.Lock()
-	for c := range h.eventChans {
-		close(c)
+	if !h.isClosed {
+		for conn := range h.serving {
+			h.closeConnection(conn, DisconnectServerClosed)
+		}
+		h.isClosed = true
+	}
+	sources := []*Source{}
+	for s := range h.sources {
+		sources = append(sources, s)
 	}
-	h.isClosed = true
 	h.mutex.Unlock()
-	h.waitGroup.Wait()
+	for _, s := range sources {
+		s.Close()
+	}
+	doneChan := make(chan struct{})
+	go func() {
+		h.waitGroup.Wait()
+		close(doneChan)
+	}()
+	select {
+	case <-doneChan:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// CloseContext closes all of the connections like ShutdownContext. If the
+// context is done before the connections complete, the remaining connections
+// are forcibly terminated, interrupting any write in progress, and the
+// context's error is returned.
+func (h *Handler) CloseContext(ctx context.Context) error {
+	err := h.ShutdownContext(ctx)
+	if err != nil {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		for conn := range h.serving {
+			conn.terminate()
+		}
+	}
+	return err
+}
+
+// Close shuts down all of the Handler's connections and waits for them to
+// complete. The Broker is left open.
+func (h *Handler) Close() {
+	h.ShutdownContext(context.Background())
 }
@@ -1,9 +1,17 @@
 package sse
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -54,6 +62,12 @@ func (h *testHandlerServerAndClient) CloseClient() {
 	}
 }
 
+type testSubscriber []string
+
+func (t testSubscriber) Topics() []string {
+	return t
+}
+
 func TestHandler(t *testing.T) {
 	for _, v := range []struct {
 		Name   string
@@ -78,8 +92,8 @@ func TestHandler(t *testing.T) {
 				return func() error {
 					defer h.Handler.mutex.Unlock()
 					h.Handler.mutex.Lock()
-					if len(h.Handler.eventChans) != 0 {
-						return errors.New("client event channel still present")
+					if len(h.Handler.conns) != 0 {
+						return errors.New("client connection still present")
 					}
 					return nil
 				}()
@@ -107,9 +121,8 @@ func TestHandler(t *testing.T) {
 				func() {
 					defer h.Handler.mutex.Unlock()
 					h.Handler.mutex.Lock()
-					for c := range h.Handler.eventChans {
-						close(c)
-						delete(h.Handler.eventChans, c)
+					for conn := range h.Handler.conns {
+						h.Handler.closeConnection(conn, DisconnectKicked)
 					}
 				}()
 				time.Sleep(CLIENT_DELAY)
@@ -137,6 +150,312 @@ func TestHandler(t *testing.T) {
 				return receiveAtLeastNEvents(2, h.Client, CLIENT_DELAY)
 			},
 		},
+		{
+			Name: "send to topic",
+			Config: &HandlerConfig{
+				SubscribeFn: func(*http.Request, any) []string {
+					return []string{"a"}
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				h.Handler.SendToTopic("b", &Event{ID: "b"})
+				h.Handler.SendToTopic("a", &Event{ID: "a"})
+				select {
+				case e := <-h.Client.Events:
+					if e.ID != "a" {
+						return fmt.Errorf("expected event \"a\", received %#v", e.ID)
+					}
+				case <-time.After(CLIENT_DELAY):
+					return errors.New("timeout waiting for event")
+				}
+				return nil
+			},
+		},
+		{
+			Name: "send to key",
+			Config: &HandlerConfig{
+				ConnectedFn: func(*http.Request) any {
+					return "1"
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				h.Handler.SendTo("2", &Event{ID: "2"})
+				h.Handler.SendToAllExcept("1", &Event{ID: "3"})
+				h.Handler.SendTo("1", &Event{ID: "1"})
+				select {
+				case e := <-h.Client.Events:
+					if e.ID != "1" {
+						return fmt.Errorf("expected event \"1\", received %#v", e.ID)
+					}
+				case <-time.After(CLIENT_DELAY):
+					return errors.New("timeout waiting for event")
+				}
+				return nil
+			},
+		},
+		{
+			Name: "enumerate and disconnect connections",
+			Fn: func(h *testHandlerServerAndClient) error {
+				conns := h.Handler.Connections()
+				if len(conns) != 1 {
+					return fmt.Errorf("expected 1 connection, found %d", len(conns))
+				}
+				if conns[0].RemoteAddr == "" {
+					return errors.New("remote address missing")
+				}
+				if !h.Handler.Disconnect(conns[0].ID) {
+					return errors.New("connection not found")
+				}
+				if h.Handler.Disconnect(conns[0].ID) {
+					return errors.New("connection disconnected twice")
+				}
+				for _, c := range h.Handler.Connections() {
+					if c.ID == conns[0].ID {
+						return errors.New("connection still present")
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name: "shutdown event",
+			Config: &HandlerConfig{
+				ShutdownEvent: &Event{Type: "server-shutdown"},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY)
+				defer cancel()
+				if err := h.Handler.ShutdownContext(ctx); err != nil {
+					return err
+				}
+				select {
+				case e := <-h.Client.Events:
+					if e.Type != "server-shutdown" {
+						return fmt.Errorf("unexpected event type %#v", e.Type)
+					}
+				case <-time.After(CLIENT_DELAY):
+					return errors.New("timeout waiting for event")
+				}
+				return nil
+			},
+		},
+		{
+			Name: "transform events",
+			Config: &HandlerConfig{
+				ChannelBufferSize: 4,
+				TransformFn: func(_ any, e *Event) *Event {
+					switch e.ID {
+					case "1":
+						return nil
+					case "2":
+						return &Event{ID: e.ID, Data: "redacted"}
+					}
+					c := *e
+					c.Type = "modified"
+					c.Data = "redacted"
+					return &c
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				h.Handler.Send(&Event{ID: "1", Data: "secret"})
+				h.Handler.Send(&Event{ID: "2", Data: "secret"})
+				h.Handler.Send(&Event{ID: "3", Data: "secret"})
+				for _, v := range []*Event{
+					{Type: defaultMessageType, ID: "2", Data: "redacted"},
+					{Type: "modified", ID: "3", Data: "redacted"},
+				} {
+					select {
+					case e := <-h.Client.Events:
+						if e.Type != v.Type || e.ID != v.ID || e.Data != v.Data {
+							return fmt.Errorf("unexpected event %+v", e)
+						}
+					case <-time.After(CLIENT_DELAY):
+						return errors.New("timeout waiting for event")
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name: "transform copied events",
+			Config: &HandlerConfig{
+				ChannelBufferSize: 4,
+				TransformFn: func(_ any, e *Event) *Event {
+					c := *e
+					c.Data = "redacted"
+					return &c
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				h.Handler.Send(&Event{ID: "1", Data: "secret"})
+				h.Handler.Send(&Event{ID: "2", Data: "secret2"})
+				for _, id := range []string{"1", "2"} {
+					select {
+					case e := <-h.Client.Events:
+						if e.ID != id || e.Data != "redacted" {
+							return fmt.Errorf("unexpected event %+v", e)
+						}
+					case <-time.After(CLIENT_DELAY):
+						return errors.New("timeout waiting for event")
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name: "generate event IDs",
+			Config: &HandlerConfig{
+				IDGenerator: NewCounterIDGenerator(0),
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				h.Handler.Send(&Event{})
+				select {
+				case e := <-h.Client.Events:
+					if e.ID != "1" {
+						return fmt.Errorf("expected ID \"1\", received %#v", e.ID)
+					}
+				case <-time.After(CLIENT_DELAY):
+					return errors.New("timeout waiting for event")
+				}
+				return nil
+			},
+		},
+		{
+			Name: "send with delivery confirmation",
+			Fn: func(h *testHandlerServerAndClient) error {
+				ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY)
+				defer cancel()
+				if err := h.Handler.SendContext(ctx, &Event{}); err != nil {
+					return err
+				}
+				return receiveAtLeastNEvents(1, h.Client, CLIENT_DELAY)
+			},
+		},
+		{
+			Name: "send to matching clients",
+			Config: &HandlerConfig{
+				ConnectedFn: func(*http.Request) any {
+					return 1
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				isEven := func(v any) bool { return v.(int)%2 == 0 }
+				if s := h.Handler.SendFunc(&Event{ID: "1"}, isEven); s.Delivered != 0 {
+					return fmt.Errorf("event delivered to %d clients", s.Delivered)
+				}
+				isOdd := func(v any) bool { return v.(int)%2 == 1 }
+				if s := h.Handler.SendFunc(&Event{ID: "2"}, isOdd); s.Delivered != 1 {
+					return fmt.Errorf("event delivered to %d clients", s.Delivered)
+				}
+				return receiveAtLeastNEvents(1, h.Client, CLIENT_DELAY)
+			},
+		},
+		{
+			Name: "coalesce flushes",
+			Config: &HandlerConfig{
+				ChannelBufferSize: 4,
+				FlushInterval:     CLIENT_DELAY / 2,
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				for i := 0; i < 3; i++ {
+					h.Handler.Send(&Event{})
+				}
+				return receiveAtLeastNEvents(3, h.Client, CLIENT_DELAY)
+			},
+		},
+		{
+			Name: "drain connections",
+			Config: &HandlerConfig{
+				DrainEvent:     &Event{Type: "drain"},
+				ReconnectDelay: time.Minute,
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY)
+				defer cancel()
+				if err := h.Handler.Drain(ctx, CLIENT_DELAY/2); err != nil {
+					return err
+				}
+				select {
+				case e := <-h.Client.Events:
+					if e.Type != "drain" {
+						return fmt.Errorf("unexpected event type %#v", e.Type)
+					}
+				case <-time.After(CLIENT_DELAY):
+					return errors.New("timeout waiting for event")
+				}
+				if n := len(h.Handler.Connections()); n != 0 {
+					return fmt.Errorf("%d connections remain", n)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "subscriber value",
+			Config: &HandlerConfig{
+				ConnectedFn: func(*http.Request) any {
+					return testSubscriber{"a"}
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				if s := h.Handler.SendToTopic("b", &Event{}); s.Delivered != 0 {
+					return fmt.Errorf("event delivered to %d clients", s.Delivered)
+				}
+				if s := h.Handler.SendToTopic("a", &Event{}); s.Delivered != 1 {
+					return fmt.Errorf("event delivered to %d clients", s.Delivered)
+				}
+				return receiveAtLeastNEvents(1, h.Client, CLIENT_DELAY)
+			},
+		},
+		{
+			Name: "audience routing",
+			Config: &HandlerConfig{
+				AudienceFn: func(*http.Request, any) []string {
+					return []string{"user:1", "role:admin"}
+				},
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				e := &Event{Audience: []string{"user:2"}}
+				if s := h.Handler.Send(e); s.Delivered != 0 {
+					return fmt.Errorf("event delivered to %d clients", s.Delivered)
+				}
+				e = &Event{Audience: []string{"user:2", "role:admin"}}
+				if s := h.Handler.Send(e); s.Delivered != 1 {
+					return fmt.Errorf("event delivered to %d clients", s.Delivered)
+				}
+				return receiveAtLeastNEvents(1, h.Client, CLIENT_DELAY)
+			},
+		},
+		{
+			Name: "heartbeat events",
+			Config: &HandlerConfig{
+				ChannelBufferSize: 4,
+				HeartbeatInterval: CLIENT_DELAY / 4,
+			},
+			Fn: func(h *testHandlerServerAndClient) error {
+				h.Handler.Send(&Event{ID: "1"})
+				tCh := time.After(CLIENT_DELAY)
+				for {
+					select {
+					case e := <-h.Client.Events:
+						if e.Type != HeartbeatEventType {
+							continue
+						}
+						hb := &Heartbeat{}
+						if err := json.Unmarshal([]byte(e.Data), hb); err != nil {
+							return err
+						}
+						if hb.Time.IsZero() {
+							return errors.New("heartbeat is missing the time")
+						}
+						if hb.LastEventID == "1" {
+							return nil
+						}
+					case <-tCh:
+						return errors.New("timeout waiting for heartbeat")
+					}
+				}
+			},
+		},
 	} {
 		func() {
 
@@ -159,3 +478,1219 @@ func TestHandler(t *testing.T) {
 		}()
 	}
 }
+
+func TestHandlerSlowClientPolicy(t *testing.T) {
+	for _, v := range []struct {
+		Name   string
+		Config *HandlerConfig
+		Ok     bool
+		ID     string
+	}{
+		{
+			Name:   "disconnect",
+			Config: &HandlerConfig{},
+			Ok:     false,
+			ID:     "1",
+		},
+		{
+			Name: "drop oldest",
+			Config: &HandlerConfig{
+				SlowClientPolicy: SlowClientDropOldest,
+			},
+			Ok: true,
+			ID: "2",
+		},
+		{
+			Name: "block with timeout",
+			Config: &HandlerConfig{
+				SlowClientPolicy:  SlowClientBlock,
+				SlowClientTimeout: CLIENT_DELAY,
+			},
+			Ok: true,
+			ID: "1",
+		},
+	} {
+		var (
+			b    = newRingBuffer(1)
+			conn = &connection{buffer: b, cfg: v.Config}
+		)
+		b.push(&Event{ID: "1"})
+		if ok := conn.enqueue(&Event{ID: "2"}); ok != v.Ok {
+			t.Fatalf("%s: %#v != %#v", v.Name, ok, v.Ok)
+		}
+		if e, _ := b.pop(); e.ID != v.ID {
+			t.Fatalf("%s: %#v != %#v", v.Name, e.ID, v.ID)
+		}
+	}
+}
+
+func TestHandlerAcceptFn(t *testing.T) {
+	for _, v := range []struct {
+		Name       string
+		Err        error
+		StatusCode int
+		Header     string
+	}{
+		{
+			Name:       "accept",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "generic error",
+			Err:        errors.New("denied"),
+			StatusCode: http.StatusForbidden,
+		},
+		{
+			Name: "HTTP error",
+			Err: &HTTPError{
+				StatusCode: http.StatusTooManyRequests,
+				Header:     http.Header{"Retry-After": []string{"10"}},
+			},
+			StatusCode: http.StatusTooManyRequests,
+			Header:     "10",
+		},
+	} {
+		h := NewHandler(&HandlerConfig{
+			AcceptFn: func(*http.Request) (any, error) {
+				return nil, v.Err
+			},
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		h.ServeHTTP(w, r)
+		h.Close()
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+		if h := w.Header().Get("Retry-After"); h != v.Header {
+			t.Fatalf("%s: %#v != %#v", v.Name, h, v.Header)
+		}
+	}
+}
+
+func TestHandlerDisconnectedFn(t *testing.T) {
+	var (
+		h        = &testHandlerServerAndClient{}
+		infoChan = make(chan *DisconnectInfo, 4)
+	)
+	h.CreateHandlerAndServer(&HandlerConfig{
+		ChannelBufferSize: 4,
+		ConnectedFn: func(*http.Request) any {
+			return "1"
+		},
+		DisconnectedFn: func(i *DisconnectInfo) {
+			infoChan <- i
+		},
+	})
+	defer h.CloseHandlerAndServer()
+	if err := h.CreateClient(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.CloseClient()
+	time.Sleep(CLIENT_DELAY)
+	h.Handler.Send(&Event{})
+	if err := receiveAtLeastNEvents(1, h.Client, CLIENT_DELAY); err != nil {
+		t.Fatal(err)
+	}
+	conns := h.Handler.Connections()
+	if len(conns) != 1 {
+		t.Fatalf("expected 1 connection, found %d", len(conns))
+	}
+	h.Handler.Disconnect(conns[0].ID)
+	select {
+	case i := <-infoChan:
+		if i.Value != "1" || i.EventsSent != 1 || i.Reason != DisconnectKicked {
+			t.Fatalf("unexpected disconnect info %+v", i)
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for DisconnectedFn")
+	}
+}
+
+type testWrappedWriter struct {
+	http.ResponseWriter
+}
+
+type testUnwrappableWriter struct {
+	http.ResponseWriter
+}
+
+func (t *testUnwrappableWriter) Unwrap() http.ResponseWriter {
+	return t.ResponseWriter
+}
+
+func TestHandlerFlusher(t *testing.T) {
+	for _, v := range []struct {
+		Name       string
+		WrapFn     func(http.ResponseWriter) http.ResponseWriter
+		StatusCode int
+	}{
+		{
+			Name: "no flusher",
+			WrapFn: func(w http.ResponseWriter) http.ResponseWriter {
+				return &testWrappedWriter{w}
+			},
+			StatusCode: http.StatusInternalServerError,
+		},
+		{
+			Name: "wrapped flusher",
+			WrapFn: func(w http.ResponseWriter) http.ResponseWriter {
+				return &testUnwrappableWriter{w}
+			},
+			StatusCode: http.StatusOK,
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			h = NewHandler(nil)
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		h.ServeHTTP(v.WrapFn(w), r)
+		h.Close()
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+	}
+}
+
+func TestHandlerPadding(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		InitFn: func(any) []*Event {
+			return []*Event{{ID: "1"}}
+		},
+		InitialPadding: 8,
+		EventPadding:   4,
+	})
+	defer h.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if v := ":      \rid:1\rdata:\r\r:  \r"; w.Body.String() != v {
+		t.Fatalf("%#v != %#v", w.Body.String(), v)
+	}
+}
+
+// testFlushRecorder records the body at the time of the first flush.
+type testFlushRecorder struct {
+	*httptest.ResponseRecorder
+	flushed *string
+}
+
+func (t *testFlushRecorder) Flush() {
+	if t.flushed == nil {
+		s := t.Body.String()
+		t.flushed = &s
+	}
+	t.ResponseRecorder.Flush()
+}
+
+func TestHandlerPreamble(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		InitFn: func(any) []*Event {
+			return []*Event{{ID: "1"}}
+		},
+		HelloComment: "ok",
+		ClientRetry:  2 * time.Second,
+	})
+	defer h.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := &testFlushRecorder{ResponseRecorder: httptest.NewRecorder()}
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if w.flushed == nil || *w.flushed != "retry:2000\r\r:ok\r" {
+		t.Fatalf("unexpected body when flushed: %#v", w.flushed)
+	}
+	if v := "retry:2000\r\r:ok\rid:1\rdata:\r\r"; w.Body.String() != v {
+		t.Fatalf("%#v != %#v", w.Body.String(), v)
+	}
+}
+
+func TestHandlerHeader(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		Header: http.Header{
+			"Cache-Control":     []string{"no-cache"},
+			"X-Accel-Buffering": []string{"no"},
+		},
+		StatusCode: http.StatusAccepted,
+	})
+	defer h.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx))
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("%#v != %#v", w.Code, http.StatusAccepted)
+	}
+	for k, v := range map[string]string{
+		"Cache-Control":     "no-cache",
+		"Content-Type":      "text/event-stream",
+		"X-Accel-Buffering": "no",
+	} {
+		if h := w.Header().Get(k); h != v {
+			t.Fatalf("%s: %#v != %#v", k, h, v)
+		}
+	}
+}
+
+func TestHandlerCompression(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		ChannelBufferSize: 4,
+		EnableCompression: true,
+	})
+	s := httptest.NewServer(h)
+	defer s.Close()
+	defer h.Close()
+	r, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	r.Header.Set("Accept-Encoding", "gzip")
+	e := &Event{ID: "1", Data: "data"}
+	go func() {
+		// Headers are not flushed until the first event is sent
+		time.Sleep(CLIENT_DELAY)
+		h.Send(e)
+	}()
+	resp, err := (&http.Transport{DisableCompression: true}).RoundTrip(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if v := resp.Header.Get("Content-Encoding"); v != "gzip" {
+		t.Fatalf("%#v != %#v", v, "gzip")
+	}
+	gz, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, len(e.Bytes()))
+	if _, err := io.ReadFull(gz, b); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, e.Bytes()) {
+		t.Fatalf("%#v != %#v", string(b), string(e.Bytes()))
+	}
+}
+
+func TestHandlerLastEventIDQueryParam(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep:       10,
+		LastEventIDQueryParam: "lastEventId",
+	})
+	for _, id := range []string{"1", "2", "3"} {
+		h.Send(&Event{ID: id})
+	}
+	for _, v := range []struct {
+		Name   string
+		URL    string
+		Header string
+		Output string
+	}{
+		{
+			Name:   "query parameter",
+			URL:    "/?lastEventId=1",
+			Output: "id:2\rdata:\r\rid:3\rdata:\r\r",
+		},
+		{
+			Name:   "header takes precedence",
+			URL:    "/?lastEventId=1",
+			Header: "2",
+			Output: "id:3\rdata:\r\r",
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, v.URL, nil).WithContext(ctx)
+		)
+		if v.Header != "" {
+			r.Header.Set("Last-Event-ID", v.Header)
+		}
+		h.ServeHTTP(w, r)
+		if b := w.Body.String(); b != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+		}
+	}
+	h.Close()
+}
+
+func TestHandlerDisableReplay(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 10,
+		DisableReplay:   true,
+	})
+	defer h.Close()
+	h.Send(&Event{ID: "1"})
+	h.Send(&Event{ID: "2"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	)
+	r.Header.Set("Last-Event-ID", "1")
+	h.ServeHTTP(w, r)
+	if b := w.Body.String(); b != "" {
+		t.Fatalf("unexpected body %#v", b)
+	}
+	if h.eventStore != nil {
+		t.Fatal("event store was created")
+	}
+}
+
+type testFailingWriter struct {
+	*httptest.ResponseRecorder
+}
+
+func (t *testFailingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestHandlerWriteFailure(t *testing.T) {
+	var reason DisconnectReason
+	h := NewHandler(&HandlerConfig{
+		WriteTimeout: CLIENT_DELAY,
+		InitFn: func(any) []*Event {
+			return []*Event{{}}
+		},
+		DisconnectedFn: func(i *DisconnectInfo) {
+			reason = i.Reason
+		},
+	})
+	h.ServeHTTP(
+		&testFailingWriter{httptest.NewRecorder()},
+		httptest.NewRequest(http.MethodGet, "/", nil),
+	)
+	h.Close()
+	if reason != DisconnectWriteFailed {
+		t.Fatalf("%#v != %#v", reason, DisconnectWriteFailed)
+	}
+	if n := len(h.Connections()); n != 0 {
+		t.Fatalf("%d connections remain", n)
+	}
+}
+
+type testBlockingWriter struct {
+	*httptest.ResponseRecorder
+	once        sync.Once
+	writingChan chan struct{}
+	unblockChan chan struct{}
+}
+
+func (t *testBlockingWriter) Write([]byte) (int, error) {
+	close(t.writingChan)
+	<-t.unblockChan
+	return 0, errors.New("deadline exceeded")
+}
+
+func (t *testBlockingWriter) SetWriteDeadline(time.Time) error {
+	t.once.Do(func() { close(t.unblockChan) })
+	return nil
+}
+
+func TestHandlerCloseContext(t *testing.T) {
+	var (
+		h = NewHandler(&HandlerConfig{
+			InitFn: func(any) []*Event {
+				return []*Event{{}}
+			},
+		})
+		w = &testBlockingWriter{
+			ResponseRecorder: httptest.NewRecorder(),
+			writingChan:      make(chan struct{}),
+			unblockChan:      make(chan struct{}),
+		}
+		doneChan = make(chan struct{})
+	)
+	go func() {
+		defer close(doneChan)
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	}()
+	<-w.writingChan
+	ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY)
+	defer cancel()
+	if err := h.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("%#v != %#v", err, context.DeadlineExceeded)
+	}
+	select {
+	case <-doneChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("connection was not terminated")
+	}
+}
+
+func TestHandlerSendStats(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		ChannelBufferSize: 1,
+	})
+	defer h.Close()
+	var (
+		b1 = newRingBuffer(1)
+		b2 = newRingBuffer(1)
+		b3 = newRingBuffer(2)
+	)
+	b2.push(&Event{})
+	b3.push(&Event{})
+	func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		for i, b := range []*ringBuffer{b1, b2, b3} {
+			h.addConnection(&connection{id: uint64(i), buffer: b, cfg: h.cfg})
+		}
+	}()
+	stats := h.Send(&Event{})
+	if v := (SendStats{Delivered: 2, Buffered: 1, Disconnected: 1}); stats != v {
+		t.Fatalf("%+v != %+v", stats, v)
+	}
+}
+
+func TestHandlerLag(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		ChannelBufferSize: 2,
+		SlowClientPolicy:  SlowClientDropOldest,
+	})
+	defer h.Close()
+	func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		h.addConnection(&connection{buffer: newRingBuffer(2), cfg: h.cfg})
+	}()
+	for i := 0; i < 3; i++ {
+		h.Send(&Event{})
+	}
+	infos := h.Connections()
+	if len(infos) != 1 {
+		t.Fatalf("%#v != %#v", len(infos), 1)
+	}
+	if infos[0].Lag != 2 {
+		t.Fatalf("%#v != %#v", infos[0].Lag, 2)
+	}
+	if infos[0].Dropped != 1 {
+		t.Fatalf("%#v != %#v", infos[0].Dropped, 1)
+	}
+}
+
+func TestHandlerMemoryBudget(t *testing.T) {
+	for _, v := range []struct {
+		Name         string
+		Policy       MemoryBudgetPolicy
+		Shed         int
+		Disconnected int
+	}{
+		{
+			Name:   "drop newest",
+			Policy: MemoryBudgetDropNewest,
+			Shed:   1,
+		},
+		{
+			Name:         "disconnect",
+			Policy:       MemoryBudgetDisconnect,
+			Disconnected: 1,
+		},
+	} {
+		func() {
+			h := NewHandler(&HandlerConfig{
+				ChannelBufferSize:  4,
+				MaxBufferedBytes:   20,
+				MemoryBudgetPolicy: v.Policy,
+			})
+			defer h.Close()
+			conn := &connection{buffer: newRingBuffer(4), cfg: h.cfg}
+			conn.buffer.budget = h.budget
+			func() {
+				defer h.mutex.Unlock()
+				h.mutex.Lock()
+				h.addConnection(conn)
+			}()
+
+			// Each event is 8 bytes, so only two fit
+			h.Send(&Event{Data: "1"})
+			h.Send(&Event{Data: "2"})
+			stats := h.Send(&Event{Data: "3"})
+			if stats.Shed != v.Shed || stats.Disconnected != v.Disconnected {
+				t.Fatalf("%s: unexpected stats %+v", v.Name, stats)
+			}
+			if v.Policy != MemoryBudgetDropNewest {
+				return
+			}
+			conn.buffer.pop()
+			if stats := h.Send(&Event{Data: "4"}); stats.Delivered != 1 {
+				t.Fatalf("%s: unexpected stats %+v", v.Name, stats)
+			}
+			e := conn.shedEvent()
+			if e == nil || e.Type != EventsDroppedEventType || e.Data != "1" {
+				t.Fatalf("%s: unexpected event %+v", v.Name, e)
+			}
+			if e := conn.shedEvent(); e != nil {
+				t.Fatalf("%s: unexpected event %+v", v.Name, e)
+			}
+		}()
+	}
+}
+
+func TestHandlerConnectionID(t *testing.T) {
+	idChan := make(chan uint64, 1)
+	h := &testHandlerServerAndClient{}
+	h.CreateHandlerAndServer(&HandlerConfig{
+		ConnectedFn: func(r *http.Request) any {
+			idChan <- ConnectionID(r.Context())
+			return nil
+		},
+	})
+	defer h.CloseHandlerAndServer()
+	if err := h.CreateClient(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.CloseClient()
+	var id uint64
+	select {
+	case id = <-idChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("ConnectedFn was not invoked")
+	}
+	time.Sleep(CLIENT_DELAY)
+	if infos := h.Handler.Connections(); len(infos) != 1 || infos[0].ID != id {
+		t.Fatalf("connection %d is not in the registry", id)
+	}
+	if h.Handler.SendToConnection(id+1, &Event{}) {
+		t.Fatal("event sent to unknown connection")
+	}
+	if !h.Handler.SendToConnection(id, &Event{Type: "direct"}) {
+		t.Fatal("connection not found")
+	}
+	select {
+	case e := <-h.Client.Events:
+		if e.Type != "direct" {
+			t.Fatalf("%#v != %#v", e.Type, "direct")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestHandlerLaggedFn(t *testing.T) {
+	laggedChan := make(chan *ConnectionInfo, 2)
+	h := NewHandler(&HandlerConfig{
+		ChannelBufferSize: 4,
+		LaggedFn: func(i *ConnectionInfo) {
+			laggedChan <- i
+		},
+		LagThreshold: 2,
+	})
+	defer h.Close()
+	b := newRingBuffer(4)
+	func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		h.addConnection(&connection{buffer: b, cfg: h.cfg})
+	}()
+	for i := 0; i < 3; i++ {
+		h.Send(&Event{})
+	}
+	select {
+	case i := <-laggedChan:
+		if i.Lag != 2 && i.Lag != 3 {
+			t.Fatalf("unexpected lag %d", i.Lag)
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("LaggedFn was not invoked")
+	}
+
+	// Catch up and then fall behind again
+	for b.len() != 0 {
+		b.pop()
+	}
+	h.Send(&Event{})
+	h.Send(&Event{})
+	select {
+	case <-laggedChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("LaggedFn was not invoked again")
+	}
+	select {
+	case <-laggedChan:
+		t.Fatal("LaggedFn was invoked too many times")
+	default:
+	}
+}
+
+func TestHandlerConnectionLimits(t *testing.T) {
+	for _, v := range []struct {
+		Name       string
+		Config     *HandlerConfig
+		RemoteAddr string
+		StatusCode int
+		RetryAfter string
+	}{
+		{
+			Name:       "under limits",
+			Config:     &HandlerConfig{MaxConnections: 2, MaxConnectionsPerIP: 2},
+			RemoteAddr: "192.0.2.1:1234",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "global limit",
+			Config:     &HandlerConfig{MaxConnections: 1},
+			RemoteAddr: "192.0.2.2:1234",
+			StatusCode: http.StatusTooManyRequests,
+			RetryAfter: "1",
+		},
+		{
+			Name: "per-IP limit",
+			Config: &HandlerConfig{
+				MaxConnectionsPerIP:       1,
+				ConnectionLimitRetryAfter: 1500 * time.Millisecond,
+			},
+			RemoteAddr: "192.0.2.1:5678",
+			StatusCode: http.StatusTooManyRequests,
+			RetryAfter: "2",
+		},
+	} {
+		h := NewHandler(v.Config)
+		func() {
+			defer h.mutex.Unlock()
+			h.mutex.Lock()
+			h.addConnection(&connection{
+				remoteIP: "192.0.2.1",
+				buffer:   newRingBuffer(1),
+			})
+		}()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		r.RemoteAddr = v.RemoteAddr
+		h.ServeHTTP(w, r)
+		h.Close()
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+		if h := w.Header().Get("Retry-After"); h != v.RetryAfter {
+			t.Fatalf("%s: %#v != %#v", v.Name, h, v.RetryAfter)
+		}
+	}
+}
+
+func TestHandlerAuthFn(t *testing.T) {
+	for _, v := range []struct {
+		Name       string
+		Err        error
+		StatusCode int
+	}{
+		{
+			Name:       "authorized",
+			StatusCode: http.StatusOK,
+		},
+		{
+			Name:       "unauthorized",
+			Err:        errors.New("invalid token"),
+			StatusCode: http.StatusUnauthorized,
+		},
+		{
+			Name:       "forbidden",
+			Err:        &HTTPError{StatusCode: http.StatusForbidden},
+			StatusCode: http.StatusForbidden,
+		},
+	} {
+		var connectedValue any
+		h := NewHandler(&HandlerConfig{
+			AuthFn: func(*http.Request) (any, error) {
+				return "user", v.Err
+			},
+			ConnectedFn: func(r *http.Request) any {
+				connectedValue = AuthValue(r.Context())
+				return connectedValue
+			},
+		})
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		h.ServeHTTP(w, r)
+		h.Close()
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+		if v.Err == nil && connectedValue != "user" {
+			t.Fatalf("%s: %#v != %#v", v.Name, connectedValue, "user")
+		}
+	}
+}
+
+func TestHandlerStreams(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 10,
+		StreamKeyFn: func(r *http.Request) string {
+			return r.URL.Query().Get("room")
+		},
+	})
+	defer h.Close()
+	h.SendToStream("a", &Event{ID: "1"})
+	h.SendToStream("b", &Event{ID: "2"})
+	h.Send(&Event{ID: "3"})
+	for _, v := range []struct {
+		Name   string
+		URL    string
+		Output string
+	}{
+		{
+			Name:   "default stream",
+			URL:    "/",
+			Output: "id:3\rdata:\r\r",
+		},
+		{
+			Name:   "named stream",
+			URL:    "/?room=a",
+			Output: "id:1\rdata:\r\r",
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, v.URL, nil).WithContext(ctx)
+		)
+		r.Header.Set("Last-Event-ID", "0")
+		h.ServeHTTP(w, r)
+		if b := w.Body.String(); b != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+		}
+	}
+}
+
+func TestHandlerStreamIDs(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep:  10,
+		StreamQueryParam: "stream",
+		StreamIDGeneratorFn: func(string) func() string {
+			return NewCounterIDGenerator(0)
+		},
+	})
+	defer h.Close()
+	h.SendToStream("a", &Event{})
+	h.SendToStream("a", &Event{})
+	h.SendToStream("b", &Event{})
+	for _, v := range []struct {
+		Name        string
+		URL         string
+		LastEventID string
+		Output      string
+	}{
+		{
+			Name:        "stream a",
+			URL:         "/?stream=a",
+			LastEventID: "1",
+			Output:      "id:2\rdata:\r\r",
+		},
+		{
+			Name:        "stream b",
+			URL:         "/?stream=b",
+			LastEventID: "1",
+			Output:      "",
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, v.URL, nil).WithContext(ctx)
+		)
+		r.Header.Set("Last-Event-ID", v.LastEventID)
+		h.ServeHTTP(w, r)
+		if b := w.Body.String(); b != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+		}
+	}
+}
+
+func TestHandlerUnknownEventID(t *testing.T) {
+	for _, v := range []struct {
+		Name   string
+		Policy UnknownEventIDPolicy
+		Output string
+	}{
+		{
+			Name:   "replay all",
+			Policy: UnknownEventIDReplayAll,
+			Output: "id:1\rdata:\r\rid:2\rdata:\r\r",
+		},
+		{
+			Name:   "replay none",
+			Policy: UnknownEventIDReplayNone,
+			Output: "",
+		},
+		{
+			Name:   "resync",
+			Policy: UnknownEventIDResync,
+			Output: "event:resync-required\rid:2\rdata:\r\r",
+		},
+	} {
+		func() {
+			h := NewHandler(&HandlerConfig{
+				NumEventsToKeep:      10,
+				UnknownEventIDPolicy: v.Policy,
+			})
+			defer h.Close()
+			h.Send(&Event{ID: "1"})
+			h.Send(&Event{ID: "2"})
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			var (
+				w = httptest.NewRecorder()
+				r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			)
+			r.Header.Set("Last-Event-ID", "0")
+			h.ServeHTTP(w, r)
+			if b := w.Body.String(); b != v.Output {
+				t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+			}
+		}()
+	}
+}
+
+func TestHandlerBackfill(t *testing.T) {
+	for _, v := range []struct {
+		Name   string
+		Err    error
+		Output string
+	}{
+		{
+			Name:   "backfill",
+			Output: "id:2\rdata:\r\rid:3\rdata:\r\r",
+		},
+		{
+			Name:   "error",
+			Err:    errors.New("error"),
+			Output: "event:resync-required\rid:3\rdata:\r\r",
+		},
+	} {
+		func() {
+			h := NewHandler(&HandlerConfig{
+				NumEventsToKeep:      1,
+				UnknownEventIDPolicy: UnknownEventIDResync,
+				BackfillFn: func(lastEventID string, _ any) ([]*Event, error) {
+					if lastEventID != "1" {
+						t.Fatalf("%s: %#v != %#v", v.Name, lastEventID, "1")
+					}
+					return []*Event{{ID: "2"}}, v.Err
+				},
+			})
+			defer h.Close()
+			h.Send(&Event{ID: "1"})
+			h.Send(&Event{ID: "2"})
+			h.Send(&Event{ID: "3"})
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			var (
+				w = httptest.NewRecorder()
+				r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+			)
+			r.Header.Set("Last-Event-ID", "1")
+			h.ServeHTTP(w, r)
+			if b := w.Body.String(); b != v.Output {
+				t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+			}
+		}()
+	}
+}
+
+func TestHandlerLastValues(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 10,
+		LastValueKeyFn: func(e *Event) string {
+			return e.Type
+		},
+	})
+	defer h.Close()
+	h.Send(&Event{Type: "a", ID: "1", Data: "1"})
+	h.Send(&Event{Type: "b", ID: "2", Data: "1"})
+	h.Send(&Event{Type: "a", ID: "3", Data: "2"})
+	h.Send(&Event{ID: "4", Data: "x"})
+	for _, v := range []struct {
+		Name        string
+		LastEventID string
+		Output      string
+	}{
+		{
+			Name:   "new client",
+			Output: "event:b\rid:2\rdata:1\r\revent:a\rid:3\rdata:2\r\r",
+		},
+		{
+			Name:        "reconnecting client",
+			LastEventID: "2",
+			Output:      "event:a\rid:3\rdata:2\r\rid:4\rdata:x\r\revent:b\rid:2\rdata:1\r\r",
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		if v.LastEventID != "" {
+			r.Header.Set("Last-Event-ID", v.LastEventID)
+		}
+		h.ServeHTTP(w, r)
+		if b := w.Body.String(); b != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+		}
+	}
+}
+
+func TestHandlerConflation(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep:   10,
+		ChannelBufferSize: 4,
+		ConflationKeyFn: func(e *Event) string {
+			return e.Type
+		},
+	})
+	defer h.Close()
+
+	// Events queued for a slow client
+	b := newRingBuffer(4)
+	func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		h.addConnection(&connection{buffer: b, cfg: h.cfg})
+	}()
+	h.Send(&Event{Type: "a", ID: "1"})
+	h.Send(&Event{Type: "b", ID: "2"})
+	h.Send(&Event{Type: "a", ID: "3"})
+	h.Send(&Event{ID: "4"})
+	for _, id := range []string{"2", "3", "4"} {
+		if e, _ := b.pop(); e == nil || e.ID != id {
+			t.Fatalf("%+v != %#v", e, id)
+		}
+	}
+
+	// Events replayed to a reconnecting client
+	h.Send(&Event{Type: "b", ID: "5"})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	)
+	r.Header.Set("Last-Event-ID", "1")
+	h.ServeHTTP(w, r)
+	var (
+		body   = w.Body.String()
+		output = "event:a\rid:3\rdata:\r\rid:4\rdata:\r\revent:b\rid:5\rdata:\r\r"
+	)
+	if body != output {
+		t.Fatalf("%#v != %#v", body, output)
+	}
+}
+
+func TestHandlerReplayComplete(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep:         10,
+		ReplayCompleteEventType: "caught-up",
+		InitFn: func(any) []*Event {
+			return []*Event{{Data: "init"}}
+		},
+	})
+	defer h.Close()
+	h.Send(&Event{ID: "1"})
+	h.Send(&Event{ID: "2"})
+	for _, v := range []struct {
+		Name        string
+		LastEventID string
+		Output      string
+	}{
+		{
+			Name:   "new client",
+			Output: "data:init\r\r",
+		},
+		{
+			Name:        "reconnecting client",
+			LastEventID: "1",
+			Output:      "id:2\rdata:\r\revent:caught-up\rdata:\r\rdata:init\r\r",
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		if v.LastEventID != "" {
+			r.Header.Set("Last-Event-ID", v.LastEventID)
+		}
+		h.ServeHTTP(w, r)
+		if b := w.Body.String(); b != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+		}
+	}
+}
+
+func BenchmarkHandlerSend(b *testing.B) {
+	h := NewHandler(&HandlerConfig{
+		ChannelBufferSize: 1,
+	})
+	defer h.Close()
+	buffers := []*ringBuffer{}
+	func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		for i := 0; i < 100; i++ {
+			b := newRingBuffer(1)
+			buffers = append(buffers, b)
+			h.addConnection(&connection{id: uint64(i), buffer: b, cfg: h.cfg})
+		}
+	}()
+	e := &Event{Type: "update", Data: `{"value":1}`}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Send(e)
+		for _, b := range buffers {
+			e, _ := b.pop()
+			e.encodedBytes()
+		}
+	}
+}
+
+func TestHandlerShards(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumShards: 4,
+	})
+	defer h.Close()
+	buffers := []*ringBuffer{}
+	func() {
+		defer h.mutex.Unlock()
+		h.mutex.Lock()
+		for i := 0; i < 10; i++ {
+			b := newRingBuffer(1)
+			buffers = append(buffers, b)
+			h.addConnection(&connection{id: uint64(i), buffer: b, cfg: h.cfg})
+		}
+		for _, shard := range h.streamConns[""] {
+			if len(shard.conns) == 0 {
+				t.Fatal("connections not distributed across shards")
+			}
+		}
+	}()
+	if stats := h.Send(&Event{}); stats.Delivered != 10 {
+		t.Fatalf("%#v != %#v", stats.Delivered, 10)
+	}
+	for _, b := range buffers {
+		if b.len() != 1 {
+			t.Fatalf("%#v != %#v", b.len(), 1)
+		}
+	}
+}
+
+func TestHandlerMaxConnectionDuration(t *testing.T) {
+	var reason DisconnectReason
+	h := NewHandler(&HandlerConfig{
+		MaxConnectionDuration: CLIENT_DELAY,
+		ReconnectDelay:        2 * time.Second,
+		DisconnectedFn: func(i *DisconnectInfo) {
+			reason = i.Reason
+		},
+	})
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	h.Close()
+	if b := w.Body.String(); b != "retry:2000\r\r" {
+		t.Fatalf("%#v != %#v", b, "retry:2000\r\r")
+	}
+	if reason != DisconnectMaxDuration {
+		t.Fatalf("%#v != %#v", reason, DisconnectMaxDuration)
+	}
+}
+
+func TestHandlerInitStreamFn(t *testing.T) {
+	for _, v := range []struct {
+		Name   string
+		Err    error
+		Reason DisconnectReason
+	}{
+		{
+			Name:   "success",
+			Reason: DisconnectClientClosed,
+		},
+		{
+			Name:   "error",
+			Err:    errors.New("snapshot failed"),
+			Reason: DisconnectInitFailed,
+		},
+	} {
+		var reason DisconnectReason
+		h := NewHandler(&HandlerConfig{
+			InitStreamFn: func(r *http.Request, _ any, w *EventWriter) error {
+				for i := 0; i < 3; i++ {
+					if err := w.Write(&Event{ID: r.URL.Query().Get("id")}); err != nil {
+						return err
+					}
+				}
+				return v.Err
+			},
+			DisconnectedFn: func(i *DisconnectInfo) {
+				reason = i.Reason
+			},
+		})
+		ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY)
+		defer cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/?id=1", nil).WithContext(ctx)
+		)
+		h.ServeHTTP(w, r)
+		h.Close()
+		if b, o := w.Body.String(), strings.Repeat("id:1\rdata:\r\r", 3); b != o {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, o)
+		}
+		if reason != v.Reason {
+			t.Fatalf("%s: %#v != %#v", v.Name, reason, v.Reason)
+		}
+	}
+}
+
+func TestHandlerInitStreamFnLiveEvents(t *testing.T) {
+	var (
+		reason DisconnectReason
+		h      *Handler
+	)
+	h = NewHandler(&HandlerConfig{
+		InitStreamFn: func(r *http.Request, _ any, w *EventWriter) error {
+			for i := 0; i < 20; i++ {
+				h.Send(&Event{Type: "live"})
+				if err := w.Write(&Event{Type: "snapshot"}); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		DisconnectedFn: func(i *DisconnectInfo) {
+			reason = i.Reason
+		},
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY)
+	defer cancel()
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	)
+	h.ServeHTTP(w, r)
+	h.Close()
+	o := strings.Repeat("event:snapshot\rdata:\r\r", 20) +
+		strings.Repeat("event:live\rdata:\r\r", 20)
+	if b := w.Body.String(); b != o {
+		t.Fatalf("%#v != %#v", b, o)
+	}
+	if reason != DisconnectClientClosed {
+		t.Fatalf("%#v != %#v", reason, DisconnectClientClosed)
+	}
+}
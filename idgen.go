@@ -0,0 +1,55 @@
+package sse
+
+import (
+	"crypto/rand"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// NewCounterIDGenerator returns an ID generator for HandlerConfig that
+// produces sequential numeric IDs beginning after start. Note that IDs will
+// repeat if the server restarts with the same starting value.
+func NewCounterIDGenerator(start uint64) func() string {
+	var (
+		mutex sync.Mutex
+		n     = start
+	)
+	return func() string {
+		defer mutex.Unlock()
+		mutex.Lock()
+		n++
+		return strconv.FormatUint(n, 10)
+	}
+}
+
+// NewTimestampIDGenerator returns an ID generator for HandlerConfig that
+// produces numeric IDs from the current time in nanoseconds. IDs are
+// guaranteed to increase even if the clock does not.
+func NewTimestampIDGenerator() func() string {
+	var (
+		mutex sync.Mutex
+		last  int64
+	)
+	return func() string {
+		defer mutex.Unlock()
+		mutex.Lock()
+		n := time.Now().UnixNano()
+		if n <= last {
+			n = last + 1
+		}
+		last = n
+		return strconv.FormatInt(n, 10)
+	}
+}
+
+// UUIDIDGenerator is an ID generator for HandlerConfig that produces random
+// (version 4) UUIDs.
+func UUIDIDGenerator() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
@@ -0,0 +1,53 @@
+package sse
+
+import (
+	"regexp"
+	"strconv"
+	"testing"
+)
+
+var uuidRegexp = regexp.MustCompile(
+	`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`,
+)
+
+func TestIDGenerators(t *testing.T) {
+	for _, v := range []struct {
+		Name      string
+		Fn        func() string
+		Increases bool
+	}{
+		{
+			Name:      "counter",
+			Fn:        NewCounterIDGenerator(10),
+			Increases: true,
+		},
+		{
+			Name:      "timestamp",
+			Fn:        NewTimestampIDGenerator(),
+			Increases: true,
+		},
+		{
+			Name: "UUID",
+			Fn:   UUIDIDGenerator,
+		},
+	} {
+		var last int64
+		for i := 0; i < 10; i++ {
+			id := v.Fn()
+			if !v.Increases {
+				if !uuidRegexp.MatchString(id) {
+					t.Fatalf("%s: invalid ID %#v", v.Name, id)
+				}
+				continue
+			}
+			n, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			if n <= last {
+				t.Fatalf("%s: %d did not increase", v.Name, n)
+			}
+			last = n
+		}
+	}
+}
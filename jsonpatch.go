@@ -0,0 +1,253 @@
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// jsonPatchOp is a single operation from an RFC 6902 JSON Patch document.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if pointer[0] != '/' {
+		return nil, fmt.Errorf("invalid JSON pointer %#v", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// arrayIndex converts a reference token to an index into an array of the
+// specified length. If allowEnd is true, the index may be equal to the length
+// (as is the case when inserting) and "-" refers to the end of the array.
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > length || (i == length && !allowEnd) ||
+		(len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index %#v", token)
+	}
+	return i, nil
+}
+
+// jsonGet returns the value that the tokens refer to.
+func jsonGet(node any, tokens []string) (any, error) {
+	for _, t := range tokens {
+		switch n := node.(type) {
+		case map[string]any:
+			v, ok := n[t]
+			if !ok {
+				return nil, fmt.Errorf("member %#v does not exist", t)
+			}
+			node = v
+		case []any:
+			i, err := arrayIndex(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			node = n[i]
+		default:
+			return nil, fmt.Errorf("cannot index %T with %#v", node, t)
+		}
+	}
+	return node, nil
+}
+
+// jsonModify invokes fn with the container that the tokens (minus the last
+// one) refer to and returns the updated document.
+func jsonModify(
+	node any,
+	tokens []string,
+	fn func(container any, token string) (any, error),
+) (any, error) {
+	if len(tokens) == 1 {
+		return fn(node, tokens[0])
+	}
+	switch n := node.(type) {
+	case map[string]any:
+		child, ok := n[tokens[0]]
+		if !ok {
+			return nil, fmt.Errorf("member %#v does not exist", tokens[0])
+		}
+		v, err := jsonModify(child, tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[tokens[0]] = v
+		return n, nil
+	case []any:
+		i, err := arrayIndex(tokens[0], len(n), false)
+		if err != nil {
+			return nil, err
+		}
+		v, err := jsonModify(n[i], tokens[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		n[i] = v
+		return n, nil
+	}
+	return nil, fmt.Errorf("cannot index %T with %#v", node, tokens[0])
+}
+
+func jsonAdd(doc any, tokens []string, value any) (any, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonModify(doc, tokens, func(container any, t string) (any, error) {
+		switch n := container.(type) {
+		case map[string]any:
+			n[t] = value
+			return n, nil
+		case []any:
+			i, err := arrayIndex(t, len(n), true)
+			if err != nil {
+				return nil, err
+			}
+			n = append(n, nil)
+			copy(n[i+1:], n[i:])
+			n[i] = value
+			return n, nil
+		}
+		return nil, fmt.Errorf("cannot add to %T", container)
+	})
+}
+
+func jsonRemove(doc any, tokens []string) (any, error) {
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return jsonModify(doc, tokens, func(container any, t string) (any, error) {
+		switch n := container.(type) {
+		case map[string]any:
+			if _, ok := n[t]; !ok {
+				return nil, fmt.Errorf("member %#v does not exist", t)
+			}
+			delete(n, t)
+			return n, nil
+		case []any:
+			i, err := arrayIndex(t, len(n), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(n[:i], n[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("cannot remove from %T", container)
+	})
+}
+
+func jsonReplace(doc any, tokens []string, value any) (any, error) {
+	if _, err := jsonGet(doc, tokens); err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return jsonModify(doc, tokens, func(container any, t string) (any, error) {
+		switch n := container.(type) {
+		case map[string]any:
+			n[t] = value
+			return n, nil
+		case []any:
+			i, _ := arrayIndex(t, len(n), false)
+			n[i] = value
+			return n, nil
+		}
+		return nil, fmt.Errorf("cannot replace in %T", container)
+	})
+}
+
+// jsonClone returns a deep copy of a decoded JSON value.
+func jsonClone(v any) any {
+	switch n := v.(type) {
+	case map[string]any:
+		m := make(map[string]any, len(n))
+		for k, child := range n {
+			m[k] = jsonClone(child)
+		}
+		return m
+	case []any:
+		l := make([]any, len(n))
+		for i, child := range n {
+			l[i] = jsonClone(child)
+		}
+		return l
+	}
+	return v
+}
+
+// applyJSONPatch applies an RFC 6902 JSON Patch to a decoded JSON document,
+// returning the new document. The original document is not modified.
+func applyJSONPatch(doc any, patch []byte) (any, error) {
+	ops := []*jsonPatchOp{}
+	if err := json.Unmarshal(patch, &ops); err != nil {
+		return nil, err
+	}
+	doc = jsonClone(doc)
+	for _, op := range ops {
+		path, err := parseJSONPointer(op.Path)
+		if err != nil {
+			return nil, err
+		}
+		var value any
+		if op.Value != nil {
+			if err := json.Unmarshal(op.Value, &value); err != nil {
+				return nil, err
+			}
+		}
+		switch op.Op {
+		case "add":
+			doc, err = jsonAdd(doc, path, value)
+		case "remove":
+			doc, err = jsonRemove(doc, path)
+		case "replace":
+			doc, err = jsonReplace(doc, path, value)
+		case "move", "copy":
+			var (
+				from []string
+				v    any
+			)
+			if from, err = parseJSONPointer(op.From); err != nil {
+				return nil, err
+			}
+			if v, err = jsonGet(doc, from); err != nil {
+				return nil, err
+			}
+			if op.Op == "move" {
+				if doc, err = jsonRemove(doc, from); err != nil {
+					return nil, err
+				}
+			} else {
+				v = jsonClone(v)
+			}
+			doc, err = jsonAdd(doc, path, v)
+		case "test":
+			var v any
+			if v, err = jsonGet(doc, path); err == nil && !reflect.DeepEqual(v, value) {
+				err = fmt.Errorf("test failed for %#v", op.Path)
+			}
+		default:
+			err = fmt.Errorf("unknown operation %#v", op.Op)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
@@ -0,0 +1,119 @@
+package sse
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestApplyJSONPatch(t *testing.T) {
+	for _, v := range []struct {
+		Name   string
+		Doc    string
+		Patch  string
+		Output string
+		Err    bool
+	}{
+		{
+			Name:   "add object member",
+			Doc:    `{"foo":"bar"}`,
+			Patch:  `[{"op":"add","path":"/baz","value":"qux"}]`,
+			Output: `{"baz":"qux","foo":"bar"}`,
+		},
+		{
+			Name:   "add array element",
+			Doc:    `{"foo":["bar","baz"]}`,
+			Patch:  `[{"op":"add","path":"/foo/1","value":"qux"}]`,
+			Output: `{"foo":["bar","qux","baz"]}`,
+		},
+		{
+			Name:   "append array element",
+			Doc:    `{"foo":["bar"]}`,
+			Patch:  `[{"op":"add","path":"/foo/-","value":"qux"}]`,
+			Output: `{"foo":["bar","qux"]}`,
+		},
+		{
+			Name:   "remove array element",
+			Doc:    `{"foo":["bar","qux","baz"]}`,
+			Patch:  `[{"op":"remove","path":"/foo/1"}]`,
+			Output: `{"foo":["bar","baz"]}`,
+		},
+		{
+			Name:   "replace value",
+			Doc:    `{"baz":"qux","foo":"bar"}`,
+			Patch:  `[{"op":"replace","path":"/baz","value":"boo"}]`,
+			Output: `{"baz":"boo","foo":"bar"}`,
+		},
+		{
+			Name:   "move value",
+			Doc:    `{"foo":{"bar":"baz","waldo":"fred"},"qux":{"corge":"grault"}}`,
+			Patch:  `[{"op":"move","from":"/foo/waldo","path":"/qux/thud"}]`,
+			Output: `{"foo":{"bar":"baz"},"qux":{"corge":"grault","thud":"fred"}}`,
+		},
+		{
+			Name:   "copy value",
+			Doc:    `{"a":{"b":1}}`,
+			Patch:  `[{"op":"copy","from":"/a","path":"/c"}]`,
+			Output: `{"a":{"b":1},"c":{"b":1}}`,
+		},
+		{
+			Name:   "escaped pointer",
+			Doc:    `{"a/b":1,"m~n":2}`,
+			Patch:  `[{"op":"replace","path":"/a~1b","value":3},{"op":"remove","path":"/m~0n"}]`,
+			Output: `{"a/b":3}`,
+		},
+		{
+			Name:   "replace root",
+			Doc:    `{"a":1}`,
+			Patch:  `[{"op":"replace","path":"","value":[1]}]`,
+			Output: `[1]`,
+		},
+		{
+			Name:   "successful test",
+			Doc:    `{"baz":"qux","foo":["a",2,"c"]}`,
+			Patch:  `[{"op":"test","path":"/baz","value":"qux"},{"op":"test","path":"/foo/1","value":2}]`,
+			Output: `{"baz":"qux","foo":["a",2,"c"]}`,
+		},
+		{
+			Name:  "failed test",
+			Doc:   `{"baz":"qux"}`,
+			Patch: `[{"op":"test","path":"/baz","value":"bar"}]`,
+			Err:   true,
+		},
+		{
+			Name:  "remove missing member",
+			Doc:   `{"foo":"bar"}`,
+			Patch: `[{"op":"remove","path":"/baz"}]`,
+			Err:   true,
+		},
+		{
+			Name:  "add to missing parent",
+			Doc:   `{"foo":"bar"}`,
+			Patch: `[{"op":"add","path":"/baz/bat","value":"qux"}]`,
+			Err:   true,
+		},
+		{
+			Name:  "invalid array index",
+			Doc:   `[1,2]`,
+			Patch: `[{"op":"add","path":"/01","value":3}]`,
+			Err:   true,
+		},
+	} {
+		var doc any
+		if err := json.Unmarshal([]byte(v.Doc), &doc); err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		output, err := applyJSONPatch(doc, []byte(v.Patch))
+		if (err != nil) != v.Err {
+			t.Fatalf("%s (err): %#v", v.Name, err)
+		}
+		if v.Err {
+			continue
+		}
+		var expected any
+		json.Unmarshal([]byte(v.Output), &expected)
+		if !reflect.DeepEqual(output, expected) {
+			t.Fatalf("%s: %#v != %#v", v.Name, output, expected)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package sse
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const defaultLatencyWindow = 100
+
+// LatencyStats summarizes the delivery latency of recent events, computed from
+// the difference between the time each event was received and the timestamp
+// the server included in it.
+type LatencyStats struct {
+
+	// Count indicates the number of samples the statistics are based on.
+	Count int
+
+	// Last is the latency of the most recent sample. Latencies are durations
+	// and may be negative if the server's clock is ahead of the client's.
+	// Last, Min, Max, and Mean are zero until the first sample is recorded.
+	Last time.Duration
+
+	// Min is the smallest latency in the window.
+	Min time.Duration
+
+	// Max is the largest latency in the window.
+	Max time.Duration
+
+	// Mean is the average latency of the samples in the window.
+	Mean time.Duration
+}
+
+// heartbeatTimestamp extracts the server time from heartbeat events.
+func heartbeatTimestamp(e *Event) (time.Time, bool) {
+	if e.Type != HeartbeatEventType {
+		return time.Time{}, false
+	}
+	h := &Heartbeat{}
+	if err := json.Unmarshal([]byte(e.Data), h); err != nil || h.Time.IsZero() {
+		return time.Time{}, false
+	}
+	return h.Time, true
+}
+
+// latencyTracker maintains a rolling window of latency samples.
+type latencyTracker struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+	next    int
+	full    bool
+}
+
+func newLatencyTracker(window int) *latencyTracker {
+	return &latencyTracker{
+		samples: make([]time.Duration, window),
+	}
+}
+
+func (l *latencyTracker) add(d time.Duration) {
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	l.samples[l.next] = d
+	l.next = (l.next + 1) % len(l.samples)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+func (l *latencyTracker) stats() LatencyStats {
+	defer l.mutex.Unlock()
+	l.mutex.Lock()
+	samples := l.samples[:l.next]
+	if l.full {
+		samples = l.samples
+	}
+	s := LatencyStats{Count: len(samples)}
+	if len(samples) == 0 {
+		return s
+	}
+	var total time.Duration
+	s.Min = samples[0]
+	s.Max = samples[0]
+	for _, d := range samples {
+		total += d
+		if d < s.Min {
+			s.Min = d
+		}
+		if d > s.Max {
+			s.Max = d
+		}
+	}
+	s.Last = l.samples[(l.next+len(l.samples)-1)%len(l.samples)]
+	s.Mean = total / time.Duration(len(samples))
+	return s
+}
@@ -0,0 +1,62 @@
+package sse
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLatencyTracker(t *testing.T) {
+	l := newLatencyTracker(3)
+	if v := l.stats(); !reflect.DeepEqual(v, LatencyStats{}) {
+		t.Fatalf("%+v != %+v", v, LatencyStats{})
+	}
+	for _, d := range []time.Duration{1, 8, 2, 3} {
+		l.add(d)
+	}
+	v := l.stats()
+	expected := LatencyStats{Count: 3, Last: 3, Min: 2, Max: 8, Mean: 4}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("%+v != %+v", v, expected)
+	}
+
+	// Negative latencies occur when the server's clock is ahead
+	l = newLatencyTracker(2)
+	l.add(-4)
+	l.add(-2)
+	v = l.stats()
+	expected = LatencyStats{Count: 2, Last: -2, Min: -4, Max: -2, Mean: -3}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("%+v != %+v", v, expected)
+	}
+}
+
+func TestClientLatency(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			b, _ := json.Marshal(&Heartbeat{
+				Time: time.Now().Add(-time.Second),
+			})
+			w.Write((&Event{Type: HeartbeatEventType, Data: string(b)}).Bytes())
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs: []string{s.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := receiveAtLeastNEvents(1, c, CLIENT_DELAY); err != nil {
+		t.Fatal(err)
+	}
+	if v := c.Latency(); v.Count != 1 || v.Last < time.Second {
+		t.Fatalf("unexpected latency: %+v", v)
+	}
+}
@@ -0,0 +1,73 @@
+package sse
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// ReconnectLimiter caps the number of connection attempts that may be in
+// progress at the same time and, optionally, the rate at which they begin. A
+// single instance is intended to be shared by many clients so that they do
+// not all reconnect at once when a server restarts.
+type ReconnectLimiter struct {
+	mutex    sync.Mutex
+	semChan  chan struct{}
+	interval time.Duration
+	next     time.Time
+}
+
+// NewReconnectLimiter creates a new ReconnectLimiter that allows up to
+// maxConcurrent connection attempts at a time, each beginning at least
+// interval after the previous one. An interval of zero disables rate
+// limiting.
+func NewReconnectLimiter(maxConcurrent int, interval time.Duration) *ReconnectLimiter {
+	if maxConcurrent <= 0 {
+		maxConcurrent = 1
+	}
+	return &ReconnectLimiter{
+		semChan:  make(chan struct{}, maxConcurrent),
+		interval: interval,
+	}
+}
+
+// Acquire blocks until a connection attempt may begin or the context is
+// canceled. Each successful call must be followed by a call to Release.
+func (l *ReconnectLimiter) Acquire(ctx context.Context) error {
+	return l.acquire(ctx, realClock{})
+}
+
+// acquire is Acquire with the clock used for spacing attempts supplied by
+// the caller, allowing clients to use their configured clock.
+func (l *ReconnectLimiter) acquire(ctx context.Context, clock Clock) error {
+	select {
+	case l.semChan <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if l.interval == 0 {
+		return nil
+	}
+	l.mutex.Lock()
+	var (
+		now = clock.Now()
+		t   = l.next
+	)
+	if t.Before(now) {
+		t = now
+	}
+	l.next = t.Add(l.interval)
+	l.mutex.Unlock()
+	select {
+	case <-clock.After(t.Sub(now)):
+		return nil
+	case <-ctx.Done():
+		l.Release()
+		return ctx.Err()
+	}
+}
+
+// Release indicates that a connection attempt has completed.
+func (l *ReconnectLimiter) Release() {
+	<-l.semChan
+}
@@ -0,0 +1,110 @@
+package sse
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestReconnectLimiter(t *testing.T) {
+	l := NewReconnectLimiter(1, 0)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// A second attempt must wait for the first to be released
+	ctx, cancel := context.WithTimeout(context.Background(), CLIENT_DELAY/4)
+	defer cancel()
+	if err := l.Acquire(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("%#v != %#v", err, context.DeadlineExceeded)
+	}
+	l.Release()
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	l.Release()
+
+	// Attempts must be spaced by the interval
+	l = NewReconnectLimiter(2, CLIENT_DELAY/2)
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		if err := l.Acquire(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if d := time.Since(start); d < CLIENT_DELAY/2 {
+		t.Fatalf("attempts were not spaced (%s)", d)
+	}
+}
+
+func TestClientReconnectLimiter(t *testing.T) {
+	l := NewReconnectLimiter(1, 0)
+	if err := l.Acquire(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClientFromConfig(&ClientConfig{
+		DialFunc: func(context.Context, string) (io.ReadCloser, error) {
+			return nil, nil
+		},
+		ReconnectLimiter: l,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	select {
+	case <-c.Events:
+		t.Fatal("client connected without acquiring the limiter")
+	case <-time.After(CLIENT_DELAY / 4):
+	}
+	l.Release()
+	select {
+	case <-c.Events:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not connect after the limiter was released")
+	}
+}
+
+func TestClientReconnectLimiterClock(t *testing.T) {
+	var (
+		l         = NewReconnectLimiter(2, time.Minute)
+		clock     = &testClock{now: time.Now()}
+		dialChan  = make(chan any, 2)
+		newClient = func() *Client {
+			c, err := NewClientFromConfig(&ClientConfig{
+				DialFunc: func(context.Context, string) (io.ReadCloser, error) {
+					dialChan <- nil
+					return nil, nil
+				},
+				Clock:            clock,
+				ReconnectLimiter: l,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c
+		}
+	)
+	c1 := newClient()
+	defer c1.Close()
+	<-dialChan
+	c2 := newClient()
+	defer c2.Close()
+
+	// The second attempt must wait on the client's clock
+	for clock.NumWaiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	select {
+	case <-dialChan:
+		t.Fatal("client connected before the clock advanced")
+	default:
+	}
+	clock.Advance(time.Minute)
+	select {
+	case <-dialChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("client did not connect after the clock advanced")
+	}
+}
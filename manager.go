@@ -0,0 +1,222 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	errClientExists   = errors.New("a client with that key already exists")
+	errClientNotFound = errors.New("no client exists with that key")
+)
+
+// ClientManagerConfig provides a means of passing configuration to
+// NewClientManager.
+type ClientManagerConfig struct {
+
+	// Transport is shared by all clients that do not provide their own
+	// http.Client. If set to nil, a clone of http.DefaultTransport is used.
+	Transport http.RoundTripper
+
+	// StartInterval indicates how long StartAll() waits between starting each
+	// client, preventing them from connecting all at once.
+	StartInterval time.Duration
+
+	// ReconnectJitter is used for clients that do not specify their own.
+	ReconnectJitter time.Duration
+}
+
+type managedClient struct {
+	cfg    *ClientConfig
+	client *Client
+	err    error
+}
+
+// ClientManager owns a set of clients identified by unique keys, allowing them
+// to share a transport and be started and stopped together.
+type ClientManager struct {
+	mutex      sync.Mutex
+	cfg        *ClientManagerConfig
+	httpClient *http.Client
+	clients    map[string]*managedClient
+}
+
+// NewClientManager creates a new ClientManager instance.
+func NewClientManager(cfg *ClientManagerConfig) *ClientManager {
+	if cfg == nil {
+		cfg = &ClientManagerConfig{}
+	}
+	transport := cfg.Transport
+	if transport == nil {
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	}
+	return &ClientManager{
+		cfg:        cfg,
+		httpClient: &http.Client{Transport: transport},
+		clients:    make(map[string]*managedClient),
+	}
+}
+
+// Add registers a client configuration with the manager. The client is not
+// connected until Start() or StartAll() is called.
+func (m *ClientManager) Add(key string, cfg *ClientConfig) error {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	if _, ok := m.clients[key]; ok {
+		return errClientExists
+	}
+	var (
+		cfgCopy    = *cfg
+		mc         = &managedClient{cfg: &cfgCopy}
+		onError    = cfg.OnError
+		onResponse = cfg.OnResponse
+	)
+	if cfgCopy.Client == nil {
+		cfgCopy.Client = m.httpClient
+	}
+	if cfgCopy.ReconnectJitter == 0 {
+		cfgCopy.ReconnectJitter = m.cfg.ReconnectJitter
+	}
+	cfgCopy.OnError = func(err error) {
+		m.setErr(mc, err)
+		if onError != nil {
+			onError(err)
+		}
+	}
+	cfgCopy.OnResponse = func(r *http.Response) {
+		if r.StatusCode == http.StatusOK {
+			m.setErr(mc, nil)
+		}
+		if onResponse != nil {
+			onResponse(r)
+		}
+	}
+	m.clients[key] = mc
+	return nil
+}
+
+func (m *ClientManager) setErr(mc *managedClient, err error) {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	mc.err = err
+}
+
+// Remove stops the client with the specified key (if it is running) and
+// removes it from the manager.
+func (m *ClientManager) Remove(key string) {
+	m.Stop(key)
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	delete(m.clients, key)
+}
+
+// Start connects the client with the specified key. Nothing happens if the
+// client is already running.
+func (m *ClientManager) Start(key string) error {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	mc, ok := m.clients[key]
+	if !ok {
+		return errClientNotFound
+	}
+	if mc.client != nil {
+		return nil
+	}
+	c, err := NewClientFromConfig(mc.cfg)
+	if err != nil {
+		return err
+	}
+	mc.client = c
+	return nil
+}
+
+// StartAll starts every client that is not already running, waiting
+// StartInterval between each one. The context can be used to abort the
+// process.
+func (m *ClientManager) StartAll(ctx context.Context) error {
+	for i, key := range m.keys() {
+		if i != 0 && m.cfg.StartInterval != 0 {
+			select {
+			case <-time.After(m.cfg.StartInterval):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if err := m.Start(key); err != nil && err != errClientNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop disconnects and shuts down the client with the specified key. The
+// client remains registered and may be started again.
+func (m *ClientManager) Stop(key string) {
+	m.mutex.Lock()
+	var c *Client
+	if mc, ok := m.clients[key]; ok {
+		c = mc.client
+		mc.client = nil
+	}
+	m.mutex.Unlock()
+	if c != nil {
+		c.Close()
+	}
+}
+
+// StopAll shuts down all running clients concurrently.
+func (m *ClientManager) StopAll() {
+	var waitGroup sync.WaitGroup
+	for _, key := range m.keys() {
+		waitGroup.Add(1)
+		go func(key string) {
+			defer waitGroup.Done()
+			m.Stop(key)
+		}(key)
+	}
+	waitGroup.Wait()
+}
+
+// Client returns the running client with the specified key or nil if it is
+// not running.
+func (m *ClientManager) Client(key string) *Client {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	if mc, ok := m.clients[key]; ok {
+		return mc.client
+	}
+	return nil
+}
+
+// Errors returns the most recent error for each client that is either
+// failing to connect or has shut down with an error.
+func (m *ClientManager) Errors() map[string]error {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	errs := make(map[string]error)
+	for key, mc := range m.clients {
+		err := mc.err
+		if mc.client != nil && mc.client.Err() != nil {
+			err = mc.client.Err()
+		}
+		if err != nil {
+			errs[key] = err
+		}
+	}
+	return errs
+}
+
+func (m *ClientManager) keys() []string {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	keys := make([]string, 0, len(m.clients))
+	for key := range m.clients {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,57 @@
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClientManager(t *testing.T) {
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/bad" {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.Write([]byte("data\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	defer s.Close()
+	m := NewClientManager(&ClientManagerConfig{
+		StartInterval: time.Millisecond,
+	})
+	for key, path := range map[string]string{
+		"1": "/",
+		"2": "/",
+		"3": "/bad",
+	} {
+		if err := m.Add(key, &ClientConfig{URLs: []string{s.URL + path}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Add("1", &ClientConfig{}); err != errClientExists {
+		t.Fatalf("%#v != %#v", err, errClientExists)
+	}
+	if err := m.StartAll(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer m.StopAll()
+	for _, key := range []string{"1", "2"} {
+		if err := receiveAtLeastNEvents(1, m.Client(key), CLIENT_DELAY); err != nil {
+			t.Fatalf("%s: %s", key, err)
+		}
+	}
+	time.Sleep(CLIENT_DELAY)
+	errs := m.Errors()
+	if _, ok := errs["3"]; !ok || len(errs) != 1 {
+		t.Fatalf("unexpected errors: %#v", errs)
+	}
+	m.Remove("3")
+	if c := m.Client("3"); c != nil {
+		t.Fatal("client was not removed")
+	}
+}
@@ -0,0 +1,133 @@
+package sse
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const mercureCookieName = "mercureAuthorization"
+
+var errHubURLRequired = errors.New("a hub URL must be provided")
+
+// MercureConfig provides a means of passing configuration to
+// NewMercureClient.
+type MercureConfig struct {
+
+	// HubURL is the URL of the Mercure hub, which usually ends in
+	// "/.well-known/mercure".
+	HubURL string
+
+	// Topics lists the topic selectors to subscribe to. Each may be an exact
+	// topic, a URI template, or "*" to match all topics.
+	Topics []string
+
+	// Token, if provided, is the JWT used to authorize the subscriber to
+	// receive private updates.
+	Token string
+
+	// UseCookie sends Token in the "mercureAuthorization" cookie instead of
+	// the Authorization header.
+	UseCookie bool
+}
+
+// NewMercureClient creates a new client that subscribes to a Mercure hub. The
+// request is built from cfg and any other options are taken from clientCfg,
+// which may be nil. Reconnection uses the Last-Event-ID header, which Mercure
+// hubs honor for retrieving missed updates.
+func NewMercureClient(cfg *MercureConfig, clientCfg *ClientConfig) (*Client, error) {
+	if cfg.HubURL == "" {
+		return nil, errHubURLRequired
+	}
+	u, err := url.Parse(cfg.HubURL)
+	if err != nil {
+		return nil, err
+	}
+	q := u.Query()
+	for _, t := range cfg.Topics {
+		q.Add("topic", t)
+	}
+	u.RawQuery = q.Encode()
+	r, err := http.NewRequest(http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Token != "" {
+		if cfg.UseCookie {
+			r.AddCookie(&http.Cookie{Name: mercureCookieName, Value: cfg.Token})
+		} else {
+			r.Header.Set("Authorization", "Bearer "+cfg.Token)
+		}
+	}
+	cfgCopy := ClientConfig{}
+	if clientCfg != nil {
+		cfgCopy = *clientCfg
+	}
+	cfgCopy.Request = r
+	cfgCopy.URLs = nil
+	return NewClientFromConfig(&cfgCopy)
+}
+
+// uriTemplateExpr converts a single RFC 6570 expression (without braces) into
+// a regular expression matching any of its expansions.
+func uriTemplateExpr(expr string) string {
+	const (
+		unreserved = `(?:[A-Za-z0-9\-._~,]|%[0-9A-Fa-f]{2})*`
+		reserved   = `[^#]*`
+	)
+	if expr == "" {
+		return ""
+	}
+	switch expr[0] {
+	case '+':
+		return reserved
+	case '#':
+		return `(?:#.*)?`
+	case '.':
+		return `(?:\.` + unreserved + `)*`
+	case '/':
+		return `(?:/` + unreserved + `)*`
+	case ';':
+		return `(?:;` + unreserved + `(?:=` + unreserved + `)?)*`
+	case '?', '&':
+		return `(?:[?&]` + unreserved + `=` + unreserved + `)*`
+	}
+	return unreserved
+}
+
+// MatchTopic determines whether a topic matches a Mercure topic selector. The
+// selector "*" matches every topic, a selector that is not a URI template
+// must match exactly, and URI templates (RFC 6570) match any topic that one of
+// their expansions could produce.
+func MatchTopic(selector, topic string) bool {
+	if selector == "*" || selector == topic {
+		return true
+	}
+	if !strings.Contains(selector, "{") {
+		return false
+	}
+	b := &strings.Builder{}
+	b.WriteString("^")
+	for {
+		start := strings.Index(selector, "{")
+		if start == -1 {
+			b.WriteString(regexp.QuoteMeta(selector))
+			break
+		}
+		end := strings.Index(selector[start:], "}")
+		if end == -1 {
+			return false
+		}
+		b.WriteString(regexp.QuoteMeta(selector[:start]))
+		b.WriteString(uriTemplateExpr(selector[start+1 : start+end]))
+		selector = selector[start+end+1:]
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(topic)
+}
@@ -0,0 +1,86 @@
+package sse
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestMatchTopic(t *testing.T) {
+	for _, v := range []struct {
+		Selector string
+		Topic    string
+		Match    bool
+	}{
+		{"*", "https://example.com/books/1", true},
+		{"https://example.com/books/1", "https://example.com/books/1", true},
+		{"https://example.com/books/1", "https://example.com/books/2", false},
+		{"https://example.com/books/{id}", "https://example.com/books/1", true},
+		{"https://example.com/books/{id}", "https://example.com/books/1/reviews", false},
+		{"https://example.com/books/{+path}", "https://example.com/books/1/reviews", true},
+		{"https://example.com/books{/id}", "https://example.com/books/1", true},
+		{"https://example.com/books/{id}.json", "https://example.com/books/1.json", true},
+		{"https://example.com/books/{id", "https://example.com/books/1", false},
+	} {
+		if m := MatchTopic(v.Selector, v.Topic); m != v.Match {
+			t.Fatalf("%s, %s: %#v != %#v", v.Selector, v.Topic, m, v.Match)
+		}
+	}
+}
+
+func TestNewMercureClient(t *testing.T) {
+	if _, err := NewMercureClient(&MercureConfig{}, nil); err != errHubURLRequired {
+		t.Fatalf("%#v != %#v", err, errHubURLRequired)
+	}
+	for _, v := range []struct {
+		Name      string
+		UseCookie bool
+	}{
+		{
+			Name:      "header",
+			UseCookie: false,
+		},
+		{
+			Name:      "cookie",
+			UseCookie: true,
+		},
+	} {
+		func() {
+			var serverErr error
+			s := httptest.NewServer(http.HandlerFunc(
+				func(w http.ResponseWriter, r *http.Request) {
+					defer w.WriteHeader(http.StatusNoContent)
+					topics := r.URL.Query()["topic"]
+					if v := []string{"a", "b/{id}"}; !reflect.DeepEqual(topics, v) {
+						serverErr = fmt.Errorf("%#v != %#v", topics, v)
+						return
+					}
+					token := r.Header.Get("Authorization")
+					if c, err := r.Cookie(mercureCookieName); err == nil {
+						token = "Bearer " + c.Value
+					}
+					if token != "Bearer token" {
+						serverErr = fmt.Errorf("unexpected token %#v", token)
+					}
+				},
+			))
+			defer s.Close()
+			c, err := NewMercureClient(&MercureConfig{
+				HubURL:    s.URL + "/.well-known/mercure",
+				Topics:    []string{"a", "b/{id}"},
+				Token:     "token",
+				UseCookie: v.UseCookie,
+			}, nil)
+			if err != nil {
+				t.Fatalf("%s: %s", v.Name, err)
+			}
+			for range c.Events {
+			}
+			if serverErr != nil {
+				t.Fatalf("%s: %s", v.Name, serverErr)
+			}
+		}()
+	}
+}
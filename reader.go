@@ -3,12 +3,24 @@ package sse
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"strconv"
-	"strings"
+	"time"
+	"unicode/utf8"
+	"unsafe"
 )
 
-// TODO: spec allows for a BOM at the beginning of the stream
+// bom is the UTF-8 byte order mark, which the spec allows at the beginning of
+// the stream.
+var bom = []byte("\xEF\xBB\xBF")
+
+var errInvalidRetry = errors.New("retry must consist of ASCII digits")
+
+// newline separates the lines of data written by NextEventTo.
+var newline = []byte{'\n'}
 
 func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	if atEOF && len(data) == 0 {
@@ -34,9 +46,180 @@ func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
 	return eol + crlf, data[0:eol], nil
 }
 
+// maxEmptyReads is the number of consecutive reads returning no data and no
+// error after which lineReader gives up, matching bufio.Scanner.
+const maxEmptyReads = 100
+
+// lineReader splits a stream into lines like bufio.Scanner but can be reset
+// to read from another stream while keeping its buffer.
+type lineReader struct {
+	rd    io.Reader
+	buf   []byte
+	max   int
+	start int
+	end   int
+	err   error
+}
+
+// reset discards any unread data and switches to reading from rd.
+func (l *lineReader) reset(rd io.Reader) {
+	l.rd = rd
+	l.start = 0
+	l.end = 0
+	l.err = nil
+}
+
+// next returns the next line and the number of bytes consumed, including the
+// line ending. False is returned if there are no more lines, in which case
+// the error, if any, is returned by Err.
+func (l *lineReader) next() ([]byte, int, bool) {
+	for {
+		if l.end > l.start || l.err != nil {
+			advance, token, _ := scanLines(l.buf[l.start:l.end], l.err != nil)
+			if advance > 0 {
+				l.start += advance
+				return token, advance, true
+			}
+			if l.err != nil {
+				return nil, 0, false
+			}
+		}
+		if l.start > 0 {
+			copy(l.buf, l.buf[l.start:l.end])
+			l.end -= l.start
+			l.start = 0
+		}
+		if l.end == len(l.buf) {
+			if len(l.buf) >= l.max {
+				l.end = 0
+				l.err = bufio.ErrTooLong
+				return nil, 0, false
+			}
+			size := len(l.buf) * 2
+			if size == 0 {
+				size = 1
+			}
+			if size > l.max {
+				size = l.max
+			}
+			buf := make([]byte, size)
+			copy(buf, l.buf[:l.end])
+			l.buf = buf
+		}
+		for i := 0; ; i++ {
+			n, err := l.rd.Read(l.buf[l.end:])
+			l.end += n
+			if err != nil {
+				l.err = err
+				break
+			}
+			if n > 0 {
+				break
+			}
+			if i == maxEmptyReads {
+				l.err = io.ErrNoProgress
+				break
+			}
+		}
+	}
+}
+
+// Err returns the error that ended the stream or nil if it ended normally.
+func (l *lineReader) Err() error {
+	if l.err == io.EOF {
+		return nil
+	}
+	return l.err
+}
+
+// SizeLimitError is returned by Reader when a line or event exceeds the limits
+// in ReaderConfig.
+type SizeLimitError struct {
+
+	// Limit is the limit that was exceeded, in bytes.
+	Limit int
+
+	// Event is true if the data of an event exceeded MaxEventSize and false
+	// if a single line exceeded MaxLineSize.
+	Event bool
+}
+
+func (e *SizeLimitError) Error() string {
+	if e.Event {
+		return fmt.Sprintf("event exceeds maximum size of %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("line exceeds maximum size of %d bytes", e.Limit)
+}
+
+// ParseError is returned by Reader in strict mode when the stream deviates
+// from the event stream format.
+type ParseError struct {
+
+	// Line is the number of the offending line, starting at 1.
+	Line int
+
+	// Reason describes the deviation.
+	Reason string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// ReaderStats provides statistics about the events read by a Reader.
+type ReaderStats struct {
+
+	// Bytes is the number of bytes of the stream that have been consumed.
+	Bytes int64
+
+	// Events is the number of events that have been read.
+	Events int
+
+	// Comments is the number of comment lines that have been read.
+	Comments int
+
+	// FieldsIgnored is the number of fields that were ignored because they
+	// were unknown or had an invalid value.
+	FieldsIgnored int
+
+	// LargestEvent is the size of the data of the largest event read.
+	LargestEvent int
+}
+
+// ReaderConfig provides a means of passing configuration to
+// NewReaderFromConfig.
+type ReaderConfig struct {
+
+	// MaxLineSize limits the length of a single line. If set to the zero
+	// value, bufio.MaxScanTokenSize (64 KiB) is used. It may be set to a
+	// very large value for streams that contain large events.
+	MaxLineSize int
+
+	// MaxEventSize, if nonzero, limits the total size of the data of a
+	// single event, which may span many lines.
+	MaxEventSize int
+
+	// OnComment, if provided, is invoked with the text of each comment line
+	// (the line without its leading colon and a single optional space) as it
+	// is read. This allows keep-alive comments sent by the server to be
+	// observed.
+	OnComment func(string)
+
+	// Strict causes deviations from the event stream format that would
+	// otherwise be ignored, such as invalid UTF-8, unknown fields, malformed
+	// retry values and NUL bytes in IDs, to be returned as a *ParseError.
+	Strict bool
+}
+
 // Reader reads events from an io.Reader.
 type Reader struct {
-	scanner *bufio.Scanner
+	lines   lineReader
+	cfg     ReaderConfig
+	started bool
+	line    int
+	data    []byte
+	evType  string
+	stats   ReaderStats
 
 	// LastEventID maintains the ID of the last event received. If the last
 	// event did not contain an ID, then the value from the previous event is
@@ -53,32 +236,123 @@ type Reader struct {
 
 // NewReader creates a new Reader instance for the provided io.Reader.
 func NewReader(r io.Reader) *Reader {
-	scanner := bufio.NewScanner(r)
-	scanner.Split(scanLines)
-	return &Reader{
-		scanner: scanner,
+	return NewReaderFromConfig(r, nil)
+}
+
+// NewReaderFromConfig creates a new Reader instance for the provided io.Reader
+// using the provided configuration. A nil configuration uses the defaults.
+func NewReaderFromConfig(r io.Reader, cfg *ReaderConfig) *Reader {
+	if cfg == nil {
+		cfg = &ReaderConfig{}
+	}
+	reader := &Reader{
+		cfg: *cfg,
+	}
+	if reader.cfg.MaxLineSize == 0 {
+		reader.cfg.MaxLineSize = bufio.MaxScanTokenSize
+	}
+	initialSize := 4096
+	if initialSize > reader.cfg.MaxLineSize {
+		initialSize = reader.cfg.MaxLineSize
 	}
+	reader.lines.buf = make([]byte, initialSize)
+
+	// The buffer must also be able to hold the line ending
+	reader.lines.max = reader.cfg.MaxLineSize + 2
+	reader.Reset(r)
+	return reader
+}
+
+// Reset discards any unread data and switches to reading from r, which is
+// useful when reconnecting. LastEventID, ReconnectionTime and the internal
+// buffers are retained.
+func (r *Reader) Reset(rd io.Reader) {
+	r.lines.reset(rd)
+	r.started = false
+	r.line = 0
 }
 
 // NextEvent blocks until the next event is received, there are no more events,
 // or an error occurs. No event or error will be returned if there are no more
 // events.
 func (r *Reader) NextEvent() (*Event, error) {
+	e := &Event{}
+	ok, err := r.read(e, false, nil)
+	if !ok {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReadEvent is like NextEvent but stores the event in e, avoiding allocations
+// when many events are read. The fields of e are only valid until the next
+// call to ReadEvent and must be copied if they are needed afterwards. False
+// is returned if there are no more events or an error occurs.
+func (r *Reader) ReadEvent(e *Event) (bool, error) {
+	return r.read(e, true, nil)
+}
+
+// NextEventTo is like NextEvent but writes the data of the event to w as it
+// is read instead of storing it in the Data field, allowing very large events
+// to be processed without holding them in memory. Data may be written for an
+// event that is never returned if the stream ends or an error occurs before
+// the event is complete.
+func (r *Reader) NextEventTo(w io.Writer) (*Event, error) {
+	e := &Event{}
+	ok, err := r.read(e, false, w)
+	if !ok {
+		return nil, err
+	}
+	return e, nil
+}
+
+// read reads the next event into e. If reuse is true, the data of the event
+// refers to an internal buffer that is overwritten by the next call. If w is
+// not nil, the data is written to it instead.
+func (r *Reader) read(e *Event, reuse bool, w io.Writer) (bool, error) {
 	var (
 		eventType = defaultMessageType
-		eventData []string
+		numData   int
+		eventSize int
 		eventID   = r.LastEventID
+		sequence  uint64
+		retry     time.Duration
 	)
-	for len(eventData) == 0 {
+	r.data = r.data[:0]
+	for numData == 0 {
 		for {
-			if !r.scanner.Scan() {
-				return nil, r.scanner.Err()
+			line, n, ok := r.lines.next()
+			if !ok {
+				err := r.lines.Err()
+				if err == bufio.ErrTooLong {
+					err = &SizeLimitError{Limit: r.cfg.MaxLineSize}
+				}
+				return false, err
+			}
+			r.stats.Bytes += int64(n)
+			r.line++
+			if len(line) > r.cfg.MaxLineSize {
+				return false, &SizeLimitError{Limit: r.cfg.MaxLineSize}
+			}
+			if !r.started {
+				line = bytes.TrimPrefix(line, bom)
+				r.started = true
 			}
-			line := r.scanner.Bytes()
 			if len(line) == 0 {
 				break
 			}
+			if r.cfg.Strict && !utf8.Valid(line) {
+				return false, r.parseError("invalid UTF-8")
+			}
 			if line[0] == ':' {
+				r.stats.Comments++
+				if r.cfg.OnComment != nil {
+					comment := line[1:]
+					if len(comment) != 0 && comment[0] == ' ' {
+						comment = comment[1:]
+					}
+					r.cfg.OnComment(string(comment))
+				}
 				continue
 			}
 			var (
@@ -94,26 +368,177 @@ func (r *Reader) NextEvent() (*Event, error) {
 			}
 			switch string(field) {
 			case fieldNameEvent:
-				eventType = string(value)
+
+				// Most streams use few event types, so the previous string
+				// is reused when possible to avoid an allocation
+				if string(value) != r.evType {
+					r.evType = string(value)
+				}
+				eventType = r.evType
 			case fieldNameData:
-				eventData = append(eventData, string(value))
+				eventSize += len(value)
+				if numData != 0 {
+					eventSize++
+				}
+				if r.cfg.MaxEventSize != 0 && eventSize > r.cfg.MaxEventSize {
+					return false, &SizeLimitError{
+						Limit: r.cfg.MaxEventSize,
+						Event: true,
+					}
+				}
+				if w != nil {
+					if numData != 0 {
+						if _, err := w.Write(newline); err != nil {
+							return false, err
+						}
+					}
+					if _, err := w.Write(value); err != nil {
+						return false, err
+					}
+				} else {
+					if numData != 0 {
+						r.data = append(r.data, '\n')
+					}
+					r.data = append(r.data, value...)
+				}
+				numData++
 			case fieldNameID:
 				if !bytes.Contains(value, []byte{'\x00'}) {
-					eventID = string(value)
-					r.LastEventID = eventID
+					if string(value) != r.LastEventID {
+						r.LastEventID = string(value)
+					}
+					eventID = r.LastEventID
+				} else {
+					r.stats.FieldsIgnored++
+					if r.cfg.Strict {
+						return false, r.parseError("NUL byte in ID")
+					}
+				}
+			case fieldNameSeq:
+				n, err := strconv.ParseUint(string(value), 10, 64)
+				if err != nil {
+					r.stats.FieldsIgnored++
+					if r.cfg.Strict {
+						return false, r.parseError("malformed seq value")
+					}
+					continue
 				}
+				sequence = n
 			case fieldNameRetry:
-				i, err := strconv.Atoi(string(value))
+				i, err := parseRetry(value)
 				if err != nil {
+					r.stats.FieldsIgnored++
+					if r.cfg.Strict {
+						return false, r.parseError("malformed retry value")
+					}
 					continue
 				}
 				r.ReconnectionTime = i
+				retry = time.Duration(i) * time.Millisecond
+			default:
+				r.stats.FieldsIgnored++
+				if r.cfg.Strict {
+					return false, r.parseError(
+						fmt.Sprintf("unknown field %q", field),
+					)
+				}
 			}
 		}
 	}
-	return &Event{
-		Type: eventType,
-		Data: strings.Join(eventData, "\n"),
-		ID:   eventID,
-	}, nil
+	r.stats.Events++
+	if eventSize > r.stats.LargestEvent {
+		r.stats.LargestEvent = eventSize
+	}
+	var data string
+	if reuse {
+		data = unsafe.String(unsafe.SliceData(r.data), len(r.data))
+	} else {
+		data = string(r.data)
+	}
+	*e = Event{
+		Type:     eventType,
+		Data:     data,
+		ID:       eventID,
+		Sequence: sequence,
+		Retry:    retry,
+	}
+	return true, nil
+}
+
+// Stats returns statistics about the events read so far. The statistics are
+// retained by Reset. Stats must not be called concurrently with the methods
+// that read events.
+func (r *Reader) Stats() ReaderStats {
+	return r.stats
+}
+
+// parseRetry parses the value of a retry field, which the spec requires to
+// consist only of ASCII digits. strconv.Atoi alone would also accept a sign.
+func parseRetry(value []byte) (int, error) {
+	if len(value) == 0 {
+		return 0, errInvalidRetry
+	}
+	for _, c := range value {
+		if c < '0' || c > '9' {
+			return 0, errInvalidRetry
+		}
+	}
+	return strconv.Atoi(string(value))
+}
+
+// parseError returns a *ParseError for the current line.
+func (r *Reader) parseError(reason string) error {
+	return &ParseError{
+		Line:   r.line,
+		Reason: reason,
+	}
+}
+
+// ReadEvents reads events from r in a separate goroutine and sends them on the
+// returned channel, which is closed when there are no more events, an error
+// occurs or ctx is done. The error, if any, is sent on the second channel,
+// which is closed at the same time. If r implements io.Closer, it is closed
+// when ctx is done to interrupt a pending read.
+func ReadEvents(ctx context.Context, r io.Reader) (<-chan *Event, <-chan error) {
+	var (
+		eventChan = make(chan *Event)
+		errChan   = make(chan error, 1)
+		doneChan  = make(chan any)
+		reader    = NewReader(r)
+	)
+	if c, ok := r.(io.Closer); ok {
+		go func() {
+			select {
+			case <-ctx.Done():
+				c.Close()
+			case <-doneChan:
+			}
+		}()
+	}
+	go func() {
+		defer close(errChan)
+		defer close(eventChan)
+		defer close(doneChan)
+		for {
+			e, err := reader.NextEvent()
+			if ctx.Err() != nil {
+				errChan <- ctx.Err()
+				return
+			}
+			if err != nil {
+				errChan <- err
+				return
+			}
+			if e == nil {
+				return
+			}
+			select {
+			case eventChan <- e:
+			case <-ctx.Done():
+				errChan <- ctx.Err()
+				return
+			}
+		}
+	}()
+	return eventChan, errChan
 }
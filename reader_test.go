@@ -1,11 +1,15 @@
 package sse
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 // String returns a string representation of the event.
@@ -133,6 +137,17 @@ func TestReader(t *testing.T) {
 			LastEventID:      "",
 			ReconnectionTime: 0,
 		},
+		{
+			Name:  "Byte order mark",
+			Input: "\xEF\xBB\xBFdata:1\n\ndata:\xEF\xBB\xBF\n\n",
+			Events: []*Event{
+				{Type: defaultMessageType, Data: "1"},
+				{Type: defaultMessageType, Data: "\xEF\xBB\xBF"},
+			},
+			Err:              nil,
+			LastEventID:      "",
+			ReconnectionTime: 0,
+		},
 		{
 			Name:             "Event with ID",
 			Input:            "id:1\ndata:\n\n",
@@ -163,11 +178,19 @@ func TestReader(t *testing.T) {
 		{
 			Name:             "Retry",
 			Input:            "data\nretry:10\n\n",
-			Events:           []*Event{{Type: defaultMessageType}},
+			Events:           []*Event{{Type: defaultMessageType, Retry: 10 * time.Millisecond}},
 			Err:              nil,
 			LastEventID:      "",
 			ReconnectionTime: 10,
 		},
+		{
+			Name:             "Sequence",
+			Input:            "seq:7\ndata\n\n",
+			Events:           []*Event{{Type: defaultMessageType, Sequence: 7}},
+			Err:              nil,
+			LastEventID:      "",
+			ReconnectionTime: 0,
+		},
 		{
 			Name:             "Bad retry",
 			Input:            "data\nretry:$\n\n",
@@ -238,3 +261,338 @@ func TestReader(t *testing.T) {
 		}
 	}
 }
+
+func TestReaderSizeLimits(t *testing.T) {
+	largeData := "data:" + strings.Repeat("x", 100000) + "\n\n"
+	for _, v := range []struct {
+		Name   string
+		Config *ReaderConfig
+		Input  string
+		Err    error
+	}{
+		{
+			Name:   "line within limit",
+			Config: &ReaderConfig{MaxLineSize: 8},
+			Input:  "data:123\r\n\r\n",
+		},
+		{
+			Name:   "line exceeding limit",
+			Config: &ReaderConfig{MaxLineSize: 8},
+			Input:  "data:1234\n\n",
+			Err:    &SizeLimitError{Limit: 8},
+		},
+		{
+			Name:   "event within limit",
+			Config: &ReaderConfig{MaxEventSize: 3},
+			Input:  "data:1\ndata:2\n\n",
+		},
+		{
+			Name:   "event exceeding limit",
+			Config: &ReaderConfig{MaxEventSize: 3},
+			Input:  "data:12\ndata:3\n\n",
+			Err:    &SizeLimitError{Limit: 3, Event: true},
+		},
+		{
+			Name:   "default line limit",
+			Config: &ReaderConfig{},
+			Input:  largeData,
+			Err:    &SizeLimitError{Limit: bufio.MaxScanTokenSize},
+		},
+		{
+			Name:  "nil config",
+			Input: largeData,
+			Err:   &SizeLimitError{Limit: bufio.MaxScanTokenSize},
+		},
+		{
+			Name:   "large line limit",
+			Config: &ReaderConfig{MaxLineSize: 1 << 20},
+			Input:  largeData,
+		},
+	} {
+		r := NewReaderFromConfig(strings.NewReader(v.Input), v.Config)
+		_, err := r.NextEvent()
+		if !reflect.DeepEqual(err, v.Err) {
+			t.Fatalf("%s: %#v != %#v", v.Name, err, v.Err)
+		}
+	}
+}
+
+func TestReaderComments(t *testing.T) {
+	var comments []string
+	r := NewReaderFromConfig(
+		strings.NewReader(":ping\r\n: hello world\r\ndata:1\r\n:\r\n\r\n"),
+		&ReaderConfig{
+			OnComment: func(c string) {
+				comments = append(comments, c)
+			},
+		},
+	)
+	e, err := r.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Data != "1" {
+		t.Fatalf("%#v != %#v", e.Data, "1")
+	}
+	if v := []string{"ping", "hello world", ""}; !reflect.DeepEqual(comments, v) {
+		t.Fatalf("%#v != %#v", comments, v)
+	}
+}
+
+func TestReaderStrict(t *testing.T) {
+	for _, v := range []struct {
+		Name  string
+		Input string
+		Err   error
+	}{
+		{
+			Name:  "valid",
+			Input: ": ping\nevent:a\nid:1\nretry:100\ndata:1\n\n",
+		},
+		{
+			Name:  "invalid UTF-8",
+			Input: "data:1\ndata:\xff\n\n",
+			Err:   &ParseError{Line: 2, Reason: "invalid UTF-8"},
+		},
+		{
+			Name:  "unknown field",
+			Input: "\ndata:1\nfoo:bar\n\n",
+			Err:   &ParseError{Line: 3, Reason: `unknown field "foo"`},
+		},
+		{
+			Name:  "malformed retry",
+			Input: "retry:abc\ndata:1\n\n",
+			Err:   &ParseError{Line: 1, Reason: "malformed retry value"},
+		},
+		{
+			Name:  "signed retry",
+			Input: "retry:+10\ndata:1\n\n",
+			Err:   &ParseError{Line: 1, Reason: "malformed retry value"},
+		},
+		{
+			Name:  "NUL in ID",
+			Input: "id:1\x002\ndata:1\n\n",
+			Err:   &ParseError{Line: 1, Reason: "NUL byte in ID"},
+		},
+	} {
+		r := NewReaderFromConfig(
+			strings.NewReader(v.Input),
+			&ReaderConfig{Strict: true},
+		)
+		_, err := r.NextEvent()
+		if !reflect.DeepEqual(err, v.Err) {
+			t.Fatalf("%s: %#v != %#v", v.Name, err, v.Err)
+		}
+	}
+}
+
+func TestReaderReadEvent(t *testing.T) {
+	var (
+		input = "event:a\nid:1\ndata:1\ndata:2\n\nevent:a\ndata:3\n\n"
+		r     = NewReader(strings.NewReader(input))
+		e     = &Event{}
+	)
+	for _, v := range []*Event{
+		{Type: "a", Data: "1\n2", ID: "1"},
+		{Type: "a", Data: "3", ID: "1"},
+	} {
+		ok, err := r.ReadEvent(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok {
+			t.Fatal("unexpected end of stream")
+		}
+		if !reflect.DeepEqual(e, v) {
+			t.Fatalf("%v != %v", e, v)
+		}
+	}
+	ok, err := r.ReadEvent(e)
+	if ok || err != nil {
+		t.Fatalf("%v, %v != false, <nil>", ok, err)
+	}
+}
+
+func TestReaderReadEventAllocs(t *testing.T) {
+	var (
+		input = strings.Repeat("event:a\nid:1\ndata:hello\ndata:world\n\n", 100)
+		r     = NewReader(strings.NewReader(input))
+		e     = &Event{}
+	)
+	r.ReadEvent(e)
+	if n := testing.AllocsPerRun(50, func() {
+		r.ReadEvent(e)
+	}); n != 0 {
+		t.Fatalf("%v != 0", n)
+	}
+}
+
+func TestReaderNextEventTo(t *testing.T) {
+	var (
+		input = "event:a\nid:1\ndata:1\ndata:2\n\ndata:3\n\n"
+		r     = NewReader(strings.NewReader(input))
+	)
+	for _, v := range []struct {
+		Event *Event
+		Data  string
+	}{
+		{
+			Event: &Event{Type: "a", ID: "1"},
+			Data:  "1\n2",
+		},
+		{
+			Event: &Event{Type: defaultMessageType, ID: "1"},
+			Data:  "3",
+		},
+	} {
+		b := &bytes.Buffer{}
+		e, err := r.NextEventTo(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(e, v.Event) {
+			t.Fatalf("%v != %v", e, v.Event)
+		}
+		if b.String() != v.Data {
+			t.Fatalf("%#v != %#v", b.String(), v.Data)
+		}
+	}
+}
+
+func TestReaderReset(t *testing.T) {
+	r := NewReader(strings.NewReader("id:1\nretry:100\ndata:1\n\ndata:2\n\n"))
+	if _, err := r.NextEvent(); err != nil {
+		t.Fatal(err)
+	}
+	r.Reset(strings.NewReader("\xEF\xBB\xBFdata:3\n\n"))
+	e, err := r.NextEvent()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v := &Event{Type: defaultMessageType, Data: "3", ID: "1"}
+	if !reflect.DeepEqual(e, v) {
+		t.Fatalf("%v != %v", e, v)
+	}
+	if r.ReconnectionTime != 100 {
+		t.Fatalf("%v != %v", r.ReconnectionTime, 100)
+	}
+}
+
+func TestReaderResetAllocs(t *testing.T) {
+	var (
+		sr = strings.NewReader("")
+		r  = NewReader(sr)
+		e  = &Event{}
+	)
+	n := testing.AllocsPerRun(100, func() {
+		sr.Reset("id:1\ndata:1\n\n")
+		r.Reset(sr)
+		if ok, err := r.ReadEvent(e); !ok {
+			t.Fatal(err)
+		}
+	})
+	if n != 0 {
+		t.Fatalf("%v != %v", n, 0)
+	}
+}
+
+func TestReadEvents(t *testing.T) {
+	eventChan, errChan := ReadEvents(
+		context.Background(),
+		strings.NewReader("data:1\n\ndata:2\n\n"),
+	)
+	var data []string
+	for e := range eventChan {
+		data = append(data, e.Data)
+	}
+	if v := []string{"1", "2"}; !reflect.DeepEqual(data, v) {
+		t.Fatalf("%#v != %#v", data, v)
+	}
+	if err := <-errChan; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReadEventsCancel(t *testing.T) {
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		r, w        = io.Pipe()
+	)
+	defer w.Close()
+	eventChan, errChan := ReadEvents(ctx, r)
+	w.Write([]byte("data:1\n\n"))
+	if e := <-eventChan; e == nil || e.Data != "1" {
+		t.Fatalf("%v != %#v", e, "1")
+	}
+	cancel()
+	if _, ok := <-eventChan; ok {
+		t.Fatal("channel not closed")
+	}
+	if err := <-errChan; err != context.Canceled {
+		t.Fatalf("%v != %v", err, context.Canceled)
+	}
+}
+
+func TestReaderRetry(t *testing.T) {
+	for _, v := range []struct {
+		Name  string
+		Input string
+		Retry int
+	}{
+		{
+			Name:  "digits",
+			Input: "retry:100\ndata:1\n\n",
+			Retry: 100,
+		},
+		{
+			Name:  "plus sign",
+			Input: "retry:+10\ndata:1\n\n",
+		},
+		{
+			Name:  "minus sign",
+			Input: "retry:-10\ndata:1\n\n",
+		},
+		{
+			Name:  "empty",
+			Input: "retry:\ndata:1\n\n",
+		},
+		{
+			Name:  "trailing space",
+			Input: "retry:10 \ndata:1\n\n",
+		},
+	} {
+		r := NewReader(strings.NewReader(v.Input))
+		if _, err := r.NextEvent(); err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if r.ReconnectionTime != v.Retry {
+			t.Fatalf("%s: %v != %v", v.Name, r.ReconnectionTime, v.Retry)
+		}
+	}
+}
+
+func TestReaderStats(t *testing.T) {
+	var (
+		input = ":ping\nfoo:bar\nretry:x\ndata:1\n\ndata:12\ndata:34\n\n"
+		r     = NewReader(strings.NewReader(input))
+	)
+	for {
+		e, err := r.NextEvent()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if e == nil {
+			break
+		}
+	}
+	v := ReaderStats{
+		Bytes:         int64(len(input)),
+		Events:        2,
+		Comments:      1,
+		FieldsIgnored: 2,
+		LargestEvent:  5,
+	}
+	if s := r.Stats(); s != v {
+		t.Fatalf("%#v != %#v", s, v)
+	}
+}
@@ -0,0 +1,55 @@
+package sse
+
+import (
+	"time"
+)
+
+// RuntimeConfig contains the settings of a Handler that can be changed while
+// it is running with Reconfigure. The fields have the same meaning as those
+// of HandlerConfig.
+type RuntimeConfig struct {
+	HeartbeatInterval   time.Duration
+	MaxConnections      int
+	MaxConnectionsPerIP int
+
+	// NumEventsToKeep, MaxEventAge, and MaxEventBytes are broker options;
+	// changing them affects every Handler using the same Broker (see
+	// Broker.SetRetention). If all three are zero, the retention limits
+	// are left unchanged.
+	NumEventsToKeep int
+	MaxEventAge     time.Duration
+	MaxEventBytes   int
+}
+
+// RuntimeConfig returns the current values of the settings that can be
+// changed with Reconfigure.
+func (h *Handler) RuntimeConfig() *RuntimeConfig {
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	cfg := *h.runtime
+	cfg.NumEventsToKeep = h.retention.NumEventsToKeep
+	cfg.MaxEventAge = h.retention.MaxAge
+	cfg.MaxEventBytes = h.retention.MaxBytes
+	return &cfg
+}
+
+// Reconfigure atomically replaces the settings that can be changed while the
+// Handler is running. Connected clients are not dropped: new connection
+// limits apply to clients that connect afterwards, the heartbeat interval is
+// applied to existing connections immediately, and stored events exceeding
+// the new retention limits are discarded. Every field is applied as given, so
+// a zero value removes the corresponding connection limit or disables
+// heartbeats; the exception is that the retention limits are kept if none of
+// them is set. RuntimeConfig can be used to obtain the current values in
+// order to change only some of them.
+func (h *Handler) Reconfigure(cfg *RuntimeConfig) {
+	if cfg.NumEventsToKeep != 0 || cfg.MaxEventAge != 0 || cfg.MaxEventBytes != 0 {
+		h.SetRetention(cfg.NumEventsToKeep, cfg.MaxEventAge, cfg.MaxEventBytes)
+	}
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	cfgCopy := *cfg
+	h.runtime = &cfgCopy
+	close(h.reconfigChan)
+	h.reconfigChan = make(chan struct{})
+}
@@ -0,0 +1,92 @@
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestHandlerReconfigure(t *testing.T) {
+	h := &testHandlerServerAndClient{}
+	h.CreateHandlerAndServer(&HandlerConfig{
+		NumEventsToKeep:   10,
+		ChannelBufferSize: 8,
+	})
+	defer h.CloseHandlerAndServer()
+	if err := h.CreateClient(); err != nil {
+		t.Fatal(err)
+	}
+	defer h.CloseClient()
+	time.Sleep(CLIENT_DELAY)
+	for i := 0; i < 5; i++ {
+		h.Handler.Send(&Event{})
+	}
+	cfg := h.Handler.RuntimeConfig()
+	if cfg.NumEventsToKeep != 10 {
+		t.Fatalf("%#v != %#v", cfg.NumEventsToKeep, 10)
+	}
+	cfg.NumEventsToKeep = 2
+	cfg.MaxConnections = 1
+	cfg.HeartbeatInterval = CLIENT_DELAY / 4
+	h.Handler.Reconfigure(cfg)
+
+	// Retention is applied to the stored events
+	if events, _ := h.Handler.replay("", ""); len(events) != 2 {
+		t.Fatalf("%#v != %#v", len(events), 2)
+	}
+
+	// The existing connection starts receiving heartbeats
+	tCh := time.After(CLIENT_DELAY)
+	for done := false; !done; {
+		select {
+		case e := <-h.Client.Events:
+			done = e.Type == HeartbeatEventType
+		case <-tCh:
+			t.Fatal("timeout waiting for heartbeat")
+		}
+	}
+
+	// The new connection limit applies to additional clients
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil)
+	)
+	h.Handler.ServeHTTP(w, r)
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("%#v != %#v", w.Code, http.StatusTooManyRequests)
+	}
+}
+
+func TestHandlerReconfigureRetention(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 10,
+	})
+	defer h.Close()
+
+	// Subscribing while reconfiguring must not race
+	doneChan := make(chan any)
+	go func() {
+		defer close(doneChan)
+		for i := 0; i < 10; i++ {
+			_, cancel := h.Subscribe(nil)
+			cancel()
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		h.Reconfigure(&RuntimeConfig{NumEventsToKeep: 5})
+	}
+	<-doneChan
+
+	// Leaving the retention limits unset keeps the current ones
+	h.Reconfigure(&RuntimeConfig{MaxConnections: 1})
+	if cfg := h.RuntimeConfig(); cfg.NumEventsToKeep != 5 {
+		t.Fatalf("%#v != %#v", cfg.NumEventsToKeep, 5)
+	}
+	for i := 0; i < 10; i++ {
+		h.Send(&Event{})
+	}
+	if events, _ := h.replay("", ""); len(events) != 5 {
+		t.Fatalf("%#v != %#v", len(events), 5)
+	}
+}
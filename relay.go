@@ -0,0 +1,83 @@
+package sse
+
+import (
+	"errors"
+)
+
+var errHandlerRequired = errors.New("a Handler must be provided")
+
+// RelayConfig provides a means of passing configuration to NewRelay.
+type RelayConfig struct {
+
+	// Client specifies how to connect to the upstream server. OnEvent is
+	// replaced by the Relay.
+	Client *ClientConfig
+
+	// Handler receives the events from the upstream server.
+	Handler *Handler
+
+	// TransformFn, if provided, is invoked for each event received from the
+	// upstream server and returns the event to send in its place. Returning
+	// nil skips the event.
+	TransformFn func(*Event) *Event
+}
+
+// Relay republishes the events from an upstream SSE server to the clients of
+// a local Handler, preserving event IDs and retry hints. Events without an ID
+// of their own are sent without one rather than with the ID of the previous
+// event, and upstream sequence numbers are discarded since the Handler
+// assigns its own. This allows a single upstream connection to be shared by
+// any number of local clients, which can be authenticated by the Handler.
+type Relay struct {
+	client *Client
+}
+
+// NewRelay connects to the upstream server and begins relaying events.
+func NewRelay(cfg *RelayConfig) (*Relay, error) {
+	if cfg.Handler == nil {
+		return nil, errHandlerRequired
+	}
+	if cfg.Client == nil {
+		return nil, errRequestRequired
+	}
+	var (
+		clientCfg = *cfg.Client
+		lastID    = cfg.Client.LastEventID
+	)
+	clientCfg.OnEvent = func(e *Event) error {
+		if e.Type == defaultMessageType {
+			e.Type = ""
+		}
+
+		// The client repeats the last ID received for events without an ID
+		// field, which would store several events under the same ID
+		if e.ID == lastID {
+			e.ID = ""
+		} else {
+			lastID = e.ID
+		}
+		e.Sequence = 0
+		if cfg.TransformFn != nil {
+			if e = cfg.TransformFn(e); e == nil {
+				return nil
+			}
+		}
+		cfg.Handler.Send(e)
+		return nil
+	}
+	c, err := NewClientFromConfig(&clientCfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Relay{client: c}, nil
+}
+
+// Err returns the error that caused the upstream client to shut down, if any.
+func (r *Relay) Err() error {
+	return r.client.Err()
+}
+
+// Close disconnects from the upstream server. The Handler is left open.
+func (r *Relay) Close() {
+	r.client.Close()
+}
@@ -0,0 +1,63 @@
+package sse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelay(t *testing.T) {
+	var (
+		upstream   = &testHandlerServerAndClient{}
+		downstream = &testHandlerServerAndClient{}
+	)
+	upstream.CreateHandlerAndServer(&HandlerConfig{EnableSequence: true})
+	defer upstream.CloseHandlerAndServer()
+	downstream.CreateHandlerAndServer(nil)
+	defer downstream.CloseHandlerAndServer()
+	if err := downstream.CreateClient(); err != nil {
+		t.Fatal(err)
+	}
+	defer downstream.CloseClient()
+	r, err := NewRelay(&RelayConfig{
+		Client:  &ClientConfig{URLs: []string{upstream.Server.URL}},
+		Handler: downstream.Handler,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	time.Sleep(CLIENT_DELAY)
+	upstream.Handler.Send(&Event{
+		Type:  "update",
+		Data:  "a\nb",
+		ID:    "5",
+		Retry: 2 * time.Second,
+	})
+	select {
+	case e := <-downstream.Client.Events:
+		v := &Event{
+			Type:  "update",
+			Data:  "a\nb",
+			ID:    "5",
+			Retry: 2 * time.Second,
+		}
+		if e.Type != v.Type || e.Data != v.Data || e.ID != v.ID ||
+			e.Retry != v.Retry || e.Sequence != 0 {
+			t.Fatalf("%+v != %+v", e, v)
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+
+	// An event without an ID must not be relayed with the previous one
+	upstream.Handler.Send(&Event{Data: "c"})
+	select {
+	case <-downstream.Client.Events:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+	events, _ := downstream.Handler.replay("", "")
+	if len(events) != 2 || events[1].ID != "" {
+		t.Fatalf("unexpected stored events %+v", events)
+	}
+}
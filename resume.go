@@ -0,0 +1,57 @@
+package sse
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var errInvalidResumeToken = errors.New("invalid resume token")
+
+// resumeBinding returns the value that resume tokens issued to the client
+// making the request are bound to.
+func (h *Handler) resumeBinding(r *http.Request) string {
+	if h.cfg.ResumeTokenBindFn == nil {
+		return ""
+	}
+	return h.cfg.ResumeTokenBindFn(r)
+}
+
+// resumeSignature computes the signature of the event ID for the binding.
+func (h *Handler) resumeSignature(binding, id string) string {
+	m := hmac.New(sha256.New, h.cfg.ResumeTokenKey)
+	m.Write([]byte(binding))
+	m.Write([]byte{0})
+	m.Write([]byte(id))
+	return base64.RawURLEncoding.EncodeToString(m.Sum(nil))
+}
+
+// signID returns the resume token for the event ID or the ID itself if
+// resume tokens are not enabled.
+func (h *Handler) signID(binding, id string) string {
+	if h.cfg.ResumeTokenKey == nil || id == "" {
+		return id
+	}
+	return id + "." + h.resumeSignature(binding, id)
+}
+
+// verifyID returns the event ID contained in the resume token, which is
+// returned unchanged if resume tokens are not enabled. The second return
+// value is false if the token was not issued to the client.
+func (h *Handler) verifyID(binding, token string) (string, bool) {
+	if h.cfg.ResumeTokenKey == nil || token == "" {
+		return token, true
+	}
+	i := strings.LastIndexByte(token, '.')
+	if i == -1 {
+		return "", false
+	}
+	id, sig := token[:i], token[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(h.resumeSignature(binding, id))) {
+		return "", false
+	}
+	return id, true
+}
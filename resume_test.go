@@ -0,0 +1,67 @@
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResumeTokens(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		NumEventsToKeep: 10,
+		ResumeTokenKey:  []byte("secret"),
+		ResumeTokenBindFn: func(r *http.Request) string {
+			return r.Header.Get("X-User")
+		},
+	})
+	defer h.Close()
+	h.Send(&Event{ID: "1"})
+	h.Send(&Event{ID: "2"})
+	for _, v := range []struct {
+		Name        string
+		User        string
+		LastEventID string
+		StatusCode  int
+		Output      string
+	}{
+		{
+			Name:        "forged ID",
+			User:        "alice",
+			LastEventID: "1",
+			StatusCode:  http.StatusBadRequest,
+		},
+		{
+			Name:        "foreign token",
+			User:        "bob",
+			LastEventID: h.signID("alice", "1"),
+			StatusCode:  http.StatusBadRequest,
+		},
+		{
+			Name:        "valid token",
+			User:        "alice",
+			LastEventID: h.signID("alice", "1"),
+			StatusCode:  http.StatusOK,
+			Output:      "id:" + h.signID("alice", "2") + "\rdata:\r\r",
+		},
+	} {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		var (
+			w = httptest.NewRecorder()
+			r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+		)
+		r.Header.Set("X-User", v.User)
+		r.Header.Set("Last-Event-ID", v.LastEventID)
+		h.ServeHTTP(w, r)
+		if w.Code != v.StatusCode {
+			t.Fatalf("%s: %#v != %#v", v.Name, w.Code, v.StatusCode)
+		}
+		if v.StatusCode != http.StatusOK {
+			continue
+		}
+		if b := w.Body.String(); b != v.Output {
+			t.Fatalf("%s: %#v != %#v", v.Name, b, v.Output)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package sse
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryBudget limits the total size of the events queued in a set of ring
+// buffers. The limit is not enforced strictly since events are checked
+// against it before being queued.
+type memoryBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// allows determines if the event can be queued. A nil budget allows
+// everything.
+func (m *memoryBudget) allows(e *Event) bool {
+	return m == nil || m.used.Load()+int64(len(e.encodedBytes())) <= m.limit
+}
+
+// add records that the event was queued.
+func (m *memoryBudget) add(e *Event) {
+	if m != nil {
+		m.used.Add(int64(len(e.encodedBytes())))
+	}
+}
+
+// remove records that the event was removed from a queue.
+func (m *memoryBudget) remove(e *Event) {
+	if m != nil {
+		m.used.Add(-int64(len(e.encodedBytes())))
+	}
+}
+
+// ringBuffer is a fixed-capacity queue of events waiting to be written to a
+// single client. The number of events in the buffer indicates how far the
+// client lags behind and the number of events discarded is tracked.
+type ringBuffer struct {
+	mutex  sync.Mutex
+	events []*Event
+	start  int
+	length int
+	closed bool
+
+	// numDropped counts the events discarded to make room for others and
+	// numConflated those replaced by a newer event with the same key
+	numDropped   uint64
+	numConflated uint64
+
+	// budget, if set, tracks the size of the events in the buffer
+	budget *memoryBudget
+
+	// overflow queues events after those in the buffer while it is held (see
+	// hold) and until the events held have been removed; allowance is the
+	// number of events beyond the capacity permitted during that time
+	overflow  []*Event
+	holding   bool
+	allowance int
+
+	// waitingSince is the time at which an event was last moved out of
+	// overflow (or the first was added to it) and is used by pushWait
+	waitingSince time.Time
+
+	// readyChan is signaled when events are added or the buffer is closed
+	readyChan chan struct{}
+}
+
+// newRingBuffer creates a ring buffer that can hold the specified number of
+// events (at least one).
+func newRingBuffer(capacity int) *ringBuffer {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &ringBuffer{
+		events:    make([]*Event, capacity),
+		readyChan: make(chan struct{}, 1),
+	}
+}
+
+func signal(c chan struct{}) {
+	select {
+	case c <- struct{}{}:
+	default:
+	}
+}
+
+// hold causes events to be queued regardless of the capacity of the buffer
+// until release is called.
+func (r *ringBuffer) hold() {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	r.holding = true
+}
+
+// release ends hold. Until the events queued beyond the capacity of the buffer
+// have been removed, that many more events may still be added.
+func (r *ringBuffer) release() {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	r.holding = false
+	r.allowance = len(r.overflow)
+}
+
+// shift moves events from overflow into free space in the buffer.
+func (r *ringBuffer) shift() {
+	for len(r.overflow) != 0 && r.length < len(r.events) {
+		r.events[(r.start+r.length)%len(r.events)] = r.overflow[0]
+		r.overflow[0] = nil
+		r.overflow = r.overflow[1:]
+		r.length++
+		r.waitingSince = time.Now()
+	}
+	if len(r.overflow) == 0 {
+		r.overflow = nil
+		r.allowance = 0
+	}
+}
+
+// push adds the event to the buffer. The return value is false if the buffer
+// is full or closed.
+func (r *ringBuffer) push(e *Event) bool {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	if r.closed {
+		return false
+	}
+	switch {
+	case len(r.overflow) == 0 && r.length < len(r.events):
+		r.events[(r.start+r.length)%len(r.events)] = e
+		r.length++
+	case r.holding || r.length+len(r.overflow) < len(r.events)+r.allowance:
+		r.overflow = append(r.overflow, e)
+	default:
+		return false
+	}
+	r.budget.add(e)
+	signal(r.readyChan)
+	return true
+}
+
+// pushWait adds the event to the buffer, queueing it in overflow if the
+// buffer is full. The return value is false if the buffer is closed or no
+// event has been removed from the buffer for the specified duration while
+// events were waiting in overflow.
+func (r *ringBuffer) pushWait(e *Event, timeout time.Duration) bool {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	if r.closed {
+		return false
+	}
+	switch {
+	case len(r.overflow) == 0 && r.length < len(r.events):
+		r.events[(r.start+r.length)%len(r.events)] = e
+		r.length++
+	case len(r.overflow) == 0:
+		r.waitingSince = time.Now()
+		r.overflow = append(r.overflow, e)
+	case time.Since(r.waitingSince) < timeout:
+		r.overflow = append(r.overflow, e)
+	default:
+		return false
+	}
+	r.budget.add(e)
+	signal(r.readyChan)
+	return true
+}
+
+// pushDropOldest adds the event to the buffer, discarding the oldest event if
+// the buffer is full. The discarded event (or nil) is returned. If the buffer
+// is closed, the new event itself is returned.
+func (r *ringBuffer) pushDropOldest(e *Event) *Event {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	if r.closed {
+		return e
+	}
+	var dropped *Event
+	if r.length == len(r.events) {
+		dropped = r.events[r.start]
+		r.events[r.start] = nil
+		r.start = (r.start + 1) % len(r.events)
+		r.length--
+		r.numDropped++
+		r.budget.remove(dropped)
+	}
+	if len(r.overflow) != 0 {
+		r.overflow = append(r.overflow, e)
+		r.shift()
+	} else {
+		r.events[(r.start+r.length)%len(r.events)] = e
+		r.length++
+	}
+	r.budget.add(e)
+	signal(r.readyChan)
+	return dropped
+}
+
+// pushEvict adds the event to a full buffer by discarding the oldest event
+// that is not critical. The discarded event is returned along with true if
+// the event was added; false is returned if the buffer is closed or every
+// event in it is critical.
+func (r *ringBuffer) pushEvict(e *Event) (*Event, bool) {
+	return r.pushReplace(e, func(evicted *Event) bool {
+		return !evicted.Critical
+	}, false)
+}
+
+// pushReplace adds the event to the end of the buffer by discarding the
+// oldest event for which match returns true. The discarded event is returned
+// along with true if the event was added; false is returned if the buffer is
+// closed, no event matches or events are queued in overflow. The discarded
+// event is counted as conflated if conflate is true and as dropped otherwise.
+func (r *ringBuffer) pushReplace(e *Event, match func(*Event) bool, conflate bool) (*Event, bool) {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	if r.closed || len(r.overflow) != 0 {
+		return nil, false
+	}
+	n := len(r.events)
+	for i := 0; i < r.length; i++ {
+		evicted := r.events[(r.start+i)%n]
+		if !match(evicted) {
+			continue
+		}
+		for ; i < r.length-1; i++ {
+			r.events[(r.start+i)%n] = r.events[(r.start+i+1)%n]
+		}
+		r.events[(r.start+r.length-1)%n] = e
+		if conflate {
+			r.numConflated++
+		} else {
+			r.numDropped++
+		}
+		r.budget.add(e)
+		r.budget.remove(evicted)
+		signal(r.readyChan)
+		return evicted, true
+	}
+	return nil, false
+}
+
+// pop removes and returns the oldest event in the buffer. If the buffer is
+// empty, nil is returned along with false if the buffer is also closed.
+func (r *ringBuffer) pop() (*Event, bool) {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	if r.length == 0 {
+		return nil, !r.closed
+	}
+	e := r.events[r.start]
+	r.events[r.start] = nil
+	r.start = (r.start + 1) % len(r.events)
+	r.length--
+	r.shift()
+	r.budget.remove(e)
+	return e, true
+}
+
+// close prevents further events from being added. Events already in the
+// buffer can still be removed.
+func (r *ringBuffer) close() {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	r.closed = true
+	signal(r.readyChan)
+}
+
+// isClosed determines if close has been called.
+func (r *ringBuffer) isClosed() bool {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	return r.closed
+}
+
+// len returns the number of events in the buffer.
+func (r *ringBuffer) len() int {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	return r.length + len(r.overflow)
+}
+
+// stats returns the number of events in the buffer, the number of events
+// dropped by pushDropOldest and pushEvict, and the number of events conflated
+// by pushReplace.
+func (r *ringBuffer) stats() (int, uint64, uint64) {
+	defer r.mutex.Unlock()
+	r.mutex.Lock()
+	return r.length + len(r.overflow), r.numDropped, r.numConflated
+}
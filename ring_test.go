@@ -0,0 +1,150 @@
+package sse
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRingBuffer(t *testing.T) {
+	r := newRingBuffer(2)
+	for _, id := range []string{"1", "2"} {
+		if !r.push(&Event{ID: id}) {
+			t.Fatalf("unable to push event %s", id)
+		}
+	}
+	if r.push(&Event{ID: "3"}) {
+		t.Fatal("pushed event into full buffer")
+	}
+	if e := r.pushDropOldest(&Event{ID: "3"}); e == nil || e.ID != "1" {
+		t.Fatalf("unexpected dropped event %+v", e)
+	}
+	if n, d, c := r.stats(); n != 2 || d != 1 || c != 0 {
+		t.Fatalf("unexpected stats %d, %d, %d", n, d, c)
+	}
+	r.close()
+	if r.push(&Event{}) {
+		t.Fatal("pushed event into closed buffer")
+	}
+	for _, id := range []string{"2", "3"} {
+		e, ok := r.pop()
+		if !ok || e.ID != id {
+			t.Fatalf("%+v != %#v", e, id)
+		}
+	}
+	if e, ok := r.pop(); e != nil || ok {
+		t.Fatalf("unexpected result %+v, %#v", e, ok)
+	}
+}
+
+func TestRingBufferEvict(t *testing.T) {
+	r := newRingBuffer(3)
+	r.push(&Event{ID: "1", Critical: true})
+	r.push(&Event{ID: "2"})
+	r.push(&Event{ID: "3"})
+	r.pop()
+	r.push(&Event{ID: "4", Critical: true})
+	if e, ok := r.pushEvict(&Event{ID: "5", Critical: true}); !ok || e.ID != "2" {
+		t.Fatalf("unexpected evicted event %+v", e)
+	}
+	if e, ok := r.pushEvict(&Event{ID: "6", Critical: true}); !ok || e.ID != "3" {
+		t.Fatalf("unexpected evicted event %+v", e)
+	}
+	if _, ok := r.pushEvict(&Event{ID: "7", Critical: true}); ok {
+		t.Fatal("evicted a critical event")
+	}
+	for _, id := range []string{"4", "5", "6"} {
+		e, ok := r.pop()
+		if !ok || e.ID != id {
+			t.Fatalf("%+v != %#v", e, id)
+		}
+	}
+}
+
+func TestRingBufferReplace(t *testing.T) {
+	r := newRingBuffer(4)
+	r.push(&Event{ID: "1", Type: "a"})
+	r.push(&Event{ID: "2", Type: "b"})
+	r.push(&Event{ID: "3", Type: "a"})
+	isA := func(e *Event) bool {
+		return e.Type == "a"
+	}
+	if e, ok := r.pushReplace(&Event{ID: "4", Type: "a"}, isA, true); !ok || e.ID != "1" {
+		t.Fatalf("unexpected replaced event %+v", e)
+	}
+	if _, ok := r.pushReplace(&Event{ID: "5", Type: "c"}, func(e *Event) bool {
+		return e.Type == "c"
+	}, true); ok {
+		t.Fatal("replaced an event that does not match")
+	}
+	if _, d, c := r.stats(); d != 0 || c != 1 {
+		t.Fatalf("unexpected stats %d, %d", d, c)
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		e, ok := r.pop()
+		if !ok || e.ID != id {
+			t.Fatalf("%+v != %#v", e, id)
+		}
+	}
+}
+
+func TestRingBufferHold(t *testing.T) {
+	r := newRingBuffer(2)
+	r.hold()
+	for _, id := range []string{"1", "2", "3", "4"} {
+		if !r.push(&Event{ID: id}) {
+			t.Fatalf("unable to push event %s", id)
+		}
+	}
+	r.release()
+	if n := r.len(); n != 4 {
+		t.Fatalf("%d != %d", n, 4)
+	}
+	if e, _ := r.pop(); e.ID != "1" {
+		t.Fatalf("%#v != %#v", e.ID, "1")
+	}
+	if !r.push(&Event{ID: "5"}) {
+		t.Fatal("unable to push event within allowance")
+	}
+	if r.push(&Event{ID: "6"}) {
+		t.Fatal("pushed event beyond allowance")
+	}
+	for _, id := range []string{"2", "3", "4", "5"} {
+		e, ok := r.pop()
+		if !ok || e.ID != id {
+			t.Fatalf("%+v != %#v", e, id)
+		}
+	}
+	for _, id := range []string{"6", "7"} {
+		if !r.push(&Event{ID: id}) {
+			t.Fatalf("unable to push event %s", id)
+		}
+	}
+	if r.push(&Event{ID: "8"}) {
+		t.Fatal("pushed event into full buffer")
+	}
+}
+
+func TestRingBufferPushWait(t *testing.T) {
+	r := newRingBuffer(1)
+	for _, id := range []string{"1", "2", "3"} {
+		if !r.pushWait(&Event{ID: id}, CLIENT_DELAY) {
+			t.Fatalf("unable to push event %s", id)
+		}
+	}
+	time.Sleep(CLIENT_DELAY)
+	if r.pushWait(&Event{ID: "4"}, CLIENT_DELAY) {
+		t.Fatal("pushed event after timeout")
+	}
+	if e, _ := r.pop(); e.ID != "1" {
+		t.Fatalf("%#v != %#v", e.ID, "1")
+	}
+	if !r.pushWait(&Event{ID: "4"}, CLIENT_DELAY) {
+		t.Fatal("unable to push event after removing one")
+	}
+	for _, id := range []string{"2", "3", "4"} {
+		e, ok := r.pop()
+		if !ok || e.ID != id {
+			t.Fatalf("%+v != %#v", e, id)
+		}
+	}
+}
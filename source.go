@@ -0,0 +1,139 @@
+package sse
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	errIntervalRequired = errors.New("a positive interval must be provided")
+	errEventFnRequired  = errors.New("an event function must be provided")
+)
+
+// SourceConfig provides a means of passing configuration to AddSource.
+type SourceConfig struct {
+
+	// Interval indicates how often EventFn is invoked and must be positive.
+	Interval time.Duration
+
+	// Jitter, if nonzero, adds a random delay of up to the specified duration
+	// to each interval so that sources do not all fire at once.
+	Jitter time.Duration
+
+	// Disabled causes the source to be created in the disabled state; it
+	// does not produce events until Enable is called.
+	Disabled bool
+
+	// EventFn is invoked on each interval and returns the event to send or
+	// nil to skip the interval. It must be provided.
+	EventFn func() *Event
+}
+
+// Source periodically sends events produced by a function. Sources are
+// closed along with the Handler they were added to.
+type Source struct {
+	handler   *Handler
+	cfg       *SourceConfig
+	enabled   atomic.Bool
+	closeOnce sync.Once
+	closeChan chan struct{}
+	doneChan  chan struct{}
+}
+
+func (s *Source) run() {
+	defer close(s.doneChan)
+	for {
+		d := s.cfg.Interval
+		if s.cfg.Jitter > 0 {
+			d += time.Duration(rand.Int63n(int64(s.cfg.Jitter)))
+		}
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+			if !s.enabled.Load() {
+				continue
+			}
+			if e := s.cfg.EventFn(); e != nil {
+				s.handler.Send(e)
+			}
+		case <-s.closeChan:
+			t.Stop()
+			return
+		}
+	}
+}
+
+// AddSource registers a function that is invoked on an interval to produce
+// events that are sent to all clients, such as periodic statistics. An error
+// is returned if Interval is not positive or EventFn is not provided.
+func (h *Handler) AddSource(cfg *SourceConfig) (*Source, error) {
+	if cfg.Interval <= 0 {
+		return nil, errIntervalRequired
+	}
+	if cfg.EventFn == nil {
+		return nil, errEventFnRequired
+	}
+	s := &Source{
+		handler:   h,
+		cfg:       cfg,
+		closeChan: make(chan struct{}),
+		doneChan:  make(chan struct{}),
+	}
+	s.enabled.Store(!cfg.Disabled)
+	defer h.mutex.Unlock()
+	h.mutex.Lock()
+	if h.isClosed {
+		close(s.doneChan)
+		return s, nil
+	}
+	h.sources[s] = struct{}{}
+	go s.run()
+	return s, nil
+}
+
+// Enable resumes producing events.
+func (s *Source) Enable() {
+	s.enabled.Store(true)
+}
+
+// Disable stops producing events until Enable is called.
+func (s *Source) Disable() {
+	s.enabled.Store(false)
+}
+
+// Close removes the source from the Handler and waits for any event being
+// produced to be sent.
+func (s *Source) Close() {
+	func() {
+		defer s.handler.mutex.Unlock()
+		s.handler.mutex.Lock()
+		delete(s.handler.sources, s)
+	}()
+	s.closeOnce.Do(func() {
+		close(s.closeChan)
+	})
+	<-s.doneChan
+}
+
+// AttachSource sends each event received on the channel to all clients until
+// the channel is closed or the context is done, making it simple to feed the
+// Handler from an internal pub/sub system.
+func (h *Handler) AttachSource(ctx context.Context, ch <-chan *Event) {
+	go func() {
+		for {
+			select {
+			case e, ok := <-ch:
+				if !ok {
+					return
+				}
+				h.Send(e)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
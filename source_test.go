@@ -0,0 +1,104 @@
+package sse
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSource(t *testing.T) {
+	var (
+		h     = NewHandler(&HandlerConfig{NumEventsToKeep: 100})
+		count atomic.Int64
+	)
+	s, err := h.AddSource(&SourceConfig{
+		Interval: time.Millisecond,
+		Jitter:   time.Millisecond,
+		Disabled: true,
+		EventFn: func() *Event {
+			count.Add(1)
+			return &Event{Type: "stats"}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(CLIENT_DELAY / 4)
+	if n := count.Load(); n != 0 {
+		t.Fatalf("disabled source produced %d events", n)
+	}
+	s.Enable()
+	time.Sleep(CLIENT_DELAY / 4)
+	if n := count.Load(); n == 0 {
+		t.Fatal("enabled source produced no events")
+	}
+	events, _ := h.replay("", "")
+	if len(events) == 0 || events[0].Type != "stats" {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	// Closing the Handler must stop the source
+	h.Close()
+	n := count.Load()
+	time.Sleep(CLIENT_DELAY / 4)
+	if count.Load() != n {
+		t.Fatal("source produced events after Handler was closed")
+	}
+}
+
+func TestSourceInvalidConfig(t *testing.T) {
+	h := NewHandler(nil)
+	defer h.Close()
+	eventFn := func() *Event {
+		return nil
+	}
+	for _, v := range []struct {
+		Name   string
+		Config *SourceConfig
+		Err    error
+	}{
+		{
+			Name:   "zero interval",
+			Config: &SourceConfig{EventFn: eventFn},
+			Err:    errIntervalRequired,
+		},
+		{
+			Name:   "negative interval",
+			Config: &SourceConfig{Interval: -time.Second, EventFn: eventFn},
+			Err:    errIntervalRequired,
+		},
+		{
+			Name:   "no event function",
+			Config: &SourceConfig{Interval: time.Second},
+			Err:    errEventFnRequired,
+		},
+	} {
+		if _, err := h.AddSource(v.Config); err != v.Err {
+			t.Fatalf("%s: %#v != %#v", v.Name, err, v.Err)
+		}
+	}
+}
+
+func TestAttachSource(t *testing.T) {
+	h := NewHandler(&HandlerConfig{NumEventsToKeep: 10})
+	defer h.Close()
+	var (
+		ctx, cancel = context.WithCancel(context.Background())
+		ch          = make(chan *Event)
+	)
+	h.AttachSource(ctx, ch)
+	ch <- &Event{ID: "1"}
+	ch <- &Event{ID: "2"}
+	cancel()
+	time.Sleep(CLIENT_DELAY / 4)
+	select {
+	case ch <- &Event{ID: "3"}:
+		t.Fatal("event received after detaching")
+	case <-time.After(CLIENT_DELAY):
+	}
+	events, _ := h.replay("", "")
+	if len(events) != 2 {
+		t.Fatalf("%#v != %#v", len(events), 2)
+	}
+}
@@ -0,0 +1,215 @@
+package sse
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+var errNothingToAck = errors.New("there are no pending events to acknowledge")
+
+// Spool durably stores events received by a client before they are
+// delivered, allowing unprocessed events to be redelivered after a restart.
+// Events are acknowledged in the order they were appended.
+type Spool interface {
+
+	// Append durably stores the event. It is invoked before the event is
+	// delivered to the application.
+	Append(e *Event) error
+
+	// Ack marks the oldest unacknowledged event as processed.
+	Ack() error
+
+	// Pending returns the events that have not been acknowledged in the order
+	// they were appended.
+	Pending() ([]*Event, error)
+
+	// LastEventID returns the ID of the last event appended.
+	LastEventID() (string, error)
+}
+
+type spoolRecord struct {
+	Ack  bool   `json:"ack,omitempty"`
+	Type string `json:"type,omitempty"`
+	Data string `json:"data,omitempty"`
+	ID   string `json:"id,omitempty"`
+}
+
+// FileSpool implements Spool using an append-only file. Each record is synced
+// to disk before Append or Ack returns. The file is compacted whenever all
+// events have been acknowledged by writing a new file alongside it and
+// renaming it into place.
+type FileSpool struct {
+	mutex       sync.Mutex
+	name        string
+	file        *os.File
+	pending     []*Event
+	lastEventID string
+	numRecords  int
+}
+
+// OpenFileSpool opens (or creates) the spool file with the specified name and
+// loads any events that were not acknowledged.
+func OpenFileSpool(name string) (*FileSpool, error) {
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := &FileSpool{name: name, file: f}
+	if err := s.load(); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSpool) load() error {
+	var (
+		r      = bufio.NewReader(s.file)
+		offset int64
+	)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+
+			// Discard a partial record left behind by an interrupted write
+			return s.file.Truncate(offset)
+		}
+		if err != nil {
+			return err
+		}
+		offset += int64(len(line))
+		rec := &spoolRecord{}
+		if err := json.Unmarshal(line, rec); err != nil {
+			return err
+		}
+		s.numRecords++
+		if rec.Ack {
+			if len(s.pending) != 0 {
+				s.pending = s.pending[1:]
+			}
+			continue
+		}
+		s.pending = append(s.pending, &Event{
+			Type: rec.Type,
+			Data: rec.Data,
+			ID:   rec.ID,
+		})
+		s.lastEventID = rec.ID
+	}
+}
+
+// writeRecords writes the records to the file and syncs it to disk.
+func writeRecords(f *os.File, records ...*spoolRecord) error {
+	for _, rec := range records {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(append(b, '\n')); err != nil {
+			return err
+		}
+	}
+	return f.Sync()
+}
+
+func (s *FileSpool) write(records ...*spoolRecord) error {
+	if err := writeRecords(s.file, records...); err != nil {
+		return err
+	}
+	s.numRecords += len(records)
+	return nil
+}
+
+// compact replaces the file with one that only records the last event ID. The
+// new file is written and synced before it is renamed over the old one, so
+// the spool is left intact if compaction fails.
+func (s *FileSpool) compact() error {
+	var (
+		tmpName = s.name + ".tmp"
+		records = []*spoolRecord{
+			{ID: s.lastEventID},
+			{Ack: true},
+		}
+	)
+	f, err := os.OpenFile(tmpName, os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if err := writeRecords(f, records...); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, s.name); err != nil {
+		f.Close()
+		os.Remove(tmpName)
+		return err
+	}
+
+	// Sync the directory so that the rename itself is durable
+	if d, err := os.Open(filepath.Dir(s.name)); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	s.file.Close()
+	s.file = f
+	s.numRecords = len(records)
+	return nil
+}
+
+// Append durably stores the event.
+func (s *FileSpool) Append(e *Event) error {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	if err := s.write(&spoolRecord{
+		Type: e.Type,
+		Data: e.Data,
+		ID:   e.ID,
+	}); err != nil {
+		return err
+	}
+	s.pending = append(s.pending, e)
+	s.lastEventID = e.ID
+	return nil
+}
+
+// Ack marks the oldest unacknowledged event as processed.
+func (s *FileSpool) Ack() error {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	if len(s.pending) == 0 {
+		return errNothingToAck
+	}
+	if err := s.write(&spoolRecord{Ack: true}); err != nil {
+		return err
+	}
+	s.pending = s.pending[1:]
+	if len(s.pending) == 0 && s.numRecords > 2 {
+		return s.compact()
+	}
+	return nil
+}
+
+// Pending returns the events that have not been acknowledged.
+func (s *FileSpool) Pending() ([]*Event, error) {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	return append([]*Event{}, s.pending...), nil
+}
+
+// LastEventID returns the ID of the last event appended.
+func (s *FileSpool) LastEventID() (string, error) {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	return s.lastEventID, nil
+}
+
+// Close closes the spool file.
+func (s *FileSpool) Close() error {
+	return s.file.Close()
+}
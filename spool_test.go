@@ -0,0 +1,144 @@
+package sse
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileSpool(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "spool")
+	s, err := OpenFileSpool(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*Event{
+		{Type: "a", Data: "1", ID: "1"},
+		{Type: "b", Data: "2", ID: "2"},
+	} {
+		if err := s.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	// Simulate an interrupted write
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"id":`))
+	f.Close()
+
+	// Reopen the spool and confirm the unacknowledged event is still there
+	s, err = OpenFileSpool(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	pending, _ := s.Pending()
+	if v := []*Event{{Type: "b", Data: "2", ID: "2"}}; !reflect.DeepEqual(pending, v) {
+		t.Fatalf("%+v != %+v", pending, v)
+	}
+	if err := s.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack(); err != errNothingToAck {
+		t.Fatalf("%#v != %#v", err, errNothingToAck)
+	}
+	if v, _ := s.LastEventID(); v != "2" {
+		t.Fatalf("%#v != %#v", v, "2")
+	}
+	if s.numRecords != 2 {
+		t.Fatalf("spool was not compacted (%d records)", s.numRecords)
+	}
+}
+
+func TestFileSpoolCompactFailure(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "spool")
+	s, err := OpenFileSpool(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []*Event{
+		{Data: "1", ID: "1"},
+		{Data: "2", ID: "2"},
+	} {
+		if err := s.Append(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Ack(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Prevent the compacted file from being created
+	if err := os.Mkdir(name+".tmp", 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Ack(); err == nil {
+		t.Fatal("compaction succeeded unexpectedly")
+	}
+	s.Close()
+	s, err = OpenFileSpool(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if v, _ := s.LastEventID(); v != "2" {
+		t.Fatalf("%#v != %#v", v, "2")
+	}
+	if pending, _ := s.Pending(); len(pending) != 0 {
+		t.Fatalf("unexpected pending events %+v", pending)
+	}
+}
+
+func TestClientSpool(t *testing.T) {
+	lastIDChan := make(chan string, 1)
+	s := httptest.NewServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			lastIDChan <- r.Header.Get("Last-Event-ID")
+			w.Write([]byte("id:3\ndata:3\n\n"))
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		},
+	))
+	defer s.Close()
+	spool, err := OpenFileSpool(filepath.Join(t.TempDir(), "spool"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer spool.Close()
+	spool.Append(&Event{ID: "1", Data: "1"})
+	spool.Append(&Event{ID: "2", Data: "2"})
+	spool.Ack()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:  []string{s.URL},
+		Spool: spool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	for _, v := range []string{"2", "3"} {
+		e := <-c.Events
+		if e.Data != v {
+			t.Fatalf("%#v != %#v", e.Data, v)
+		}
+		if err := c.Ack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if v := <-lastIDChan; v != "2" {
+		t.Fatalf("%#v != %#v", v, "2")
+	}
+	if pending, _ := spool.Pending(); len(pending) != 0 {
+		t.Fatalf("unexpected pending events: %+v", pending)
+	}
+}
@@ -0,0 +1,154 @@
+package sse
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+)
+
+const (
+	defaultSnapshotEventType = "snapshot"
+	defaultPatchEventType    = "patch"
+)
+
+// ErrResyncRequired is returned by StateSync.Apply when a patch cannot be
+// applied because no snapshot has been received or events were missed and no
+// ResyncFn was provided. Patches are ignored until the next snapshot.
+var ErrResyncRequired = errors.New("a new snapshot is required")
+
+// StateSyncConfig provides a means of passing configuration to NewStateSync.
+type StateSyncConfig struct {
+
+	// SnapshotType is the type of events containing a complete JSON document.
+	// The default value is "snapshot".
+	SnapshotType string
+
+	// PatchType is the type of events containing an RFC 6902 JSON Patch. The
+	// default value is "patch".
+	PatchType string
+
+	// GapFn, if provided, is invoked with the ID of the last event applied and
+	// the ID of a patch, returning true if events were missed in between. If
+	// not provided, IDs are treated as sequence numbers that increase by one
+	// and IDs that are not numeric are never considered to have a gap.
+	GapFn func(prevID, id string) bool
+
+	// ResyncFn, if provided, is invoked when a gap is detected to retrieve a
+	// new snapshot out of band, returning the document and the ID of the last
+	// event it includes.
+	ResyncFn func() (data []byte, id string, err error)
+}
+
+// StateSync maintains a local copy of a JSON document using an initial
+// snapshot event and subsequent JSON Patch events.
+type StateSync struct {
+	mutex  sync.Mutex
+	cfg    *StateSyncConfig
+	doc    any
+	lastID string
+	valid  bool
+}
+
+func sequentialGap(prevID, id string) bool {
+	prev, err := strconv.ParseUint(prevID, 10, 64)
+	if err != nil {
+		return false
+	}
+	cur, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return false
+	}
+	return cur != prev+1
+}
+
+// NewStateSync creates a new StateSync instance.
+func NewStateSync(cfg *StateSyncConfig) *StateSync {
+	cfgCopy := StateSyncConfig{}
+	if cfg != nil {
+		cfgCopy = *cfg
+	}
+	if cfgCopy.SnapshotType == "" {
+		cfgCopy.SnapshotType = defaultSnapshotEventType
+	}
+	if cfgCopy.PatchType == "" {
+		cfgCopy.PatchType = defaultPatchEventType
+	}
+	if cfgCopy.GapFn == nil {
+		cfgCopy.GapFn = sequentialGap
+	}
+	return &StateSync{
+		cfg: &cfgCopy,
+	}
+}
+
+func (s *StateSync) load(data []byte, id string) error {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	s.doc = doc
+	s.lastID = id
+	s.valid = true
+	return nil
+}
+
+func (s *StateSync) resync() error {
+	s.valid = false
+	if s.cfg.ResyncFn == nil {
+		return ErrResyncRequired
+	}
+	data, id, err := s.cfg.ResyncFn()
+	if err != nil {
+		return err
+	}
+	return s.load(data, id)
+}
+
+// Apply updates the document with the provided event. Events that are neither
+// snapshots nor patches are ignored.
+func (s *StateSync) Apply(e *Event) error {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	switch e.Type {
+	case s.cfg.SnapshotType:
+		return s.load([]byte(e.Data), e.ID)
+	case s.cfg.PatchType:
+	default:
+		return nil
+	}
+	if !s.valid || s.cfg.GapFn(s.lastID, e.ID) {
+		if err := s.resync(); err != nil {
+			return err
+		}
+
+		// The new snapshot may already include this patch
+		if s.cfg.GapFn(s.lastID, e.ID) {
+			return nil
+		}
+	}
+	doc, err := applyJSONPatch(s.doc, []byte(e.Data))
+	if err != nil {
+		s.valid = false
+		return err
+	}
+	s.doc = doc
+	s.lastID = e.ID
+	return nil
+}
+
+// Unmarshal decodes the current document into v.
+func (s *StateSync) Unmarshal(v any) error {
+	b, err := s.JSON()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// JSON returns the JSON encoding of the current document.
+func (s *StateSync) JSON() ([]byte, error) {
+	defer s.mutex.Unlock()
+	s.mutex.Lock()
+	return json.Marshal(s.doc)
+}
@@ -0,0 +1,75 @@
+package sse
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStateSync(t *testing.T) {
+	for _, v := range []struct {
+		Name     string
+		Config   *StateSyncConfig
+		Events   []*Event
+		Err      error
+		Document map[string]any
+	}{
+		{
+			Name: "snapshot and patches",
+			Events: []*Event{
+				{Type: "snapshot", ID: "1", Data: `{"a":1}`},
+				{Type: "patch", ID: "2", Data: `[{"op":"add","path":"/b","value":2}]`},
+				{Type: "message", ID: "3"},
+			},
+			Document: map[string]any{"a": 1.0, "b": 2.0},
+		},
+		{
+			Name: "patch without snapshot",
+			Events: []*Event{
+				{Type: "patch", ID: "1", Data: `[]`},
+			},
+			Err: ErrResyncRequired,
+		},
+		{
+			Name: "gap without resync",
+			Events: []*Event{
+				{Type: "snapshot", ID: "1", Data: `{"a":1}`},
+				{Type: "patch", ID: "3", Data: `[]`},
+			},
+			Err:      ErrResyncRequired,
+			Document: map[string]any{"a": 1.0},
+		},
+		{
+			Name: "gap with resync",
+			Config: &StateSyncConfig{
+				ResyncFn: func() ([]byte, string, error) {
+					return []byte(`{"a":2}`), "2", nil
+				},
+			},
+			Events: []*Event{
+				{Type: "snapshot", ID: "1", Data: `{"a":1}`},
+				{Type: "patch", ID: "3", Data: `[{"op":"add","path":"/b","value":3}]`},
+			},
+			Document: map[string]any{"a": 2.0, "b": 3.0},
+		},
+	} {
+		var (
+			s   = NewStateSync(v.Config)
+			err error
+		)
+		for _, e := range v.Events {
+			if err = s.Apply(e); err != nil {
+				break
+			}
+		}
+		if err != v.Err {
+			t.Fatalf("%s (err): %#v != %#v", v.Name, err, v.Err)
+		}
+		var doc map[string]any
+		if err := s.Unmarshal(&doc); err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if !reflect.DeepEqual(doc, v.Document) {
+			t.Fatalf("%s: %#v != %#v", v.Name, doc, v.Document)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package sse
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrEventNotFound is returned by EventStore.Since when the store does not
+// contain an event with the requested ID.
+var ErrEventNotFound = errors.New("event not found in store")
+
+// EventStore stores events sent by a Handler so that they can be replayed to
+// clients that reconnect with a Last-Event-ID. The Handler serializes calls
+// to the store.
+type EventStore interface {
+
+	// Append adds the event to the store.
+	Append(e *Event) error
+
+	// Since returns all events stored after the event with the provided ID in
+	// the order they were appended. If lastEventID is empty, all events are
+	// returned. If no event with the ID is stored, ErrEventNotFound is
+	// returned.
+	Since(lastEventID string) ([]*Event, error)
+
+	// Trim discards any events that fall outside of the store's retention
+	// limits. It is invoked after each call to Append.
+	Trim() error
+}
+
+// MemoryEventStoreConfig provides a means of passing configuration to
+// NewMemoryEventStoreFromConfig.
+type MemoryEventStoreConfig struct {
+
+	// NumEventsToKeep indicates the maximum number of events to retain. If
+	// zero and either MaxAge or MaxBytes is set, the number of events is not
+	// limited.
+	NumEventsToKeep int
+
+	// MaxAge, if nonzero, indicates how long events are retained.
+	MaxAge time.Duration
+
+	// MaxBytes, if nonzero, limits the total encoded size of the retained
+	// events.
+	MaxBytes int
+
+	// Clock is used for determining the age of events. If nil, the system
+	// clock is used.
+	Clock Clock
+}
+
+type memoryEvent struct {
+	event    *Event
+	storedAt time.Time
+	size     int
+}
+
+// expired determines if the event's TTL has elapsed.
+func (m *memoryEvent) expired(now time.Time) bool {
+	return m.event.TTL != 0 && now.Sub(m.storedAt) >= m.event.TTL
+}
+
+// MemoryEventStore implements EventStore using an in-memory slice. It is the
+// default store used by Handler.
+type MemoryEventStore struct {
+	mutex    sync.Mutex
+	cfg      MemoryEventStoreConfig
+	events   []*memoryEvent
+	numBytes int
+}
+
+// NewMemoryEventStore creates a new MemoryEventStore that retains the
+// specified number of events.
+func NewMemoryEventStore(numEventsToKeep int) *MemoryEventStore {
+	return NewMemoryEventStoreFromConfig(&MemoryEventStoreConfig{
+		NumEventsToKeep: numEventsToKeep,
+	})
+}
+
+// NewMemoryEventStoreFromConfig creates a new MemoryEventStore with the
+// retention limits specified in the config.
+func NewMemoryEventStoreFromConfig(cfg *MemoryEventStoreConfig) *MemoryEventStore {
+	m := &MemoryEventStore{
+		cfg: *cfg,
+	}
+	if m.cfg.Clock == nil {
+		m.cfg.Clock = realClock{}
+	}
+	return m
+}
+
+// Append adds the event to the store.
+func (m *MemoryEventStore) Append(e *Event) error {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	size := len(e.encodedBytes())
+	m.events = append(m.events, &memoryEvent{
+		event:    e,
+		storedAt: m.cfg.Clock.Now(),
+		size:     size,
+	})
+	m.numBytes += size
+	return nil
+}
+
+// Since returns all events stored after the event with the provided ID.
+// Events whose TTL has elapsed are omitted.
+func (m *MemoryEventStore) Since(lastEventID string) ([]*Event, error) {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	m.trim()
+	lastEventIdx := -1
+	if lastEventID != "" {
+		for i, e := range m.events {
+			if lastEventID == e.event.ID {
+				lastEventIdx = i
+			}
+		}
+		if lastEventIdx == -1 {
+			return nil, ErrEventNotFound
+		}
+	}
+	var (
+		now    = m.cfg.Clock.Now()
+		events = []*Event{}
+	)
+	for _, e := range m.events[lastEventIdx+1:] {
+		if !e.expired(now) {
+			events = append(events, e.event)
+		}
+	}
+	return events, nil
+}
+
+// Trim discards the oldest events until the retention limits are satisfied
+// and the oldest remaining event has not expired. Expired events that follow
+// unexpired ones are retained (but not returned by Since) so that their IDs
+// can still be found.
+func (m *MemoryEventStore) Trim() error {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	m.trim()
+	return nil
+}
+
+// SetLimits changes the limits on the events retained, immediately discarding
+// any events that exceed the new limits. The parameters have the same meaning
+// as the fields of MemoryEventStoreConfig.
+func (m *MemoryEventStore) SetLimits(numEventsToKeep int, maxAge time.Duration, maxBytes int) {
+	defer m.mutex.Unlock()
+	m.mutex.Lock()
+	m.cfg.NumEventsToKeep = numEventsToKeep
+	m.cfg.MaxAge = maxAge
+	m.cfg.MaxBytes = maxBytes
+	m.trim()
+}
+
+func (m *MemoryEventStore) trim() {
+	limitCount := m.cfg.NumEventsToKeep != 0 ||
+		(m.cfg.MaxAge == 0 && m.cfg.MaxBytes == 0)
+	now := m.cfg.Clock.Now()
+	n := 0
+	for n < len(m.events) {
+		var (
+			e         = m.events[n]
+			remaining = len(m.events) - n
+		)
+		if !(limitCount && remaining > m.cfg.NumEventsToKeep) &&
+			!(m.cfg.MaxAge != 0 && now.Sub(e.storedAt) > m.cfg.MaxAge) &&
+			!(m.cfg.MaxBytes != 0 && m.numBytes > m.cfg.MaxBytes) &&
+			!e.expired(now) {
+			break
+		}
+		m.numBytes -= e.size
+		n++
+	}
+
+	// Reslicing avoids copying the retained events each time; the space
+	// before them is reclaimed when append next grows the slice
+	for i := 0; i < n; i++ {
+		m.events[i] = nil
+	}
+	m.events = m.events[n:]
+}
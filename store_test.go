@@ -0,0 +1,153 @@
+package sse
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMemoryEventStore(t *testing.T) {
+	s := NewMemoryEventStore(2)
+	for _, e := range []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}} {
+		s.Append(e)
+		s.Trim()
+	}
+	for _, v := range []struct {
+		Name        string
+		LastEventID string
+		Events      []*Event
+		Err         error
+	}{
+		{
+			Name:   "all events",
+			Events: []*Event{{ID: "2"}, {ID: "3"}},
+		},
+		{
+			Name:        "events since ID",
+			LastEventID: "2",
+			Events:      []*Event{{ID: "3"}},
+		},
+		{
+			Name:        "no newer events",
+			LastEventID: "3",
+			Events:      []*Event{},
+		},
+		{
+			Name:        "trimmed event",
+			LastEventID: "1",
+			Err:         ErrEventNotFound,
+		},
+	} {
+		events, err := s.Since(v.LastEventID)
+		if err != v.Err {
+			t.Fatalf("%s: %#v != %#v", v.Name, err, v.Err)
+		}
+		if err == nil && !reflect.DeepEqual(events, v.Events) {
+			t.Fatalf("%s: %+v != %+v", v.Name, events, v.Events)
+		}
+	}
+}
+
+func TestMemoryEventStoreRetention(t *testing.T) {
+	for _, v := range []struct {
+		Name   string
+		Config *MemoryEventStoreConfig
+		Events []*Event
+	}{
+		{
+			Name:   "max age",
+			Config: &MemoryEventStoreConfig{MaxAge: 2 * time.Second},
+			Events: []*Event{{ID: "2"}, {ID: "3"}},
+		},
+		{
+			Name: "max bytes",
+			Config: &MemoryEventStoreConfig{
+				MaxBytes: len((&Event{ID: "1"}).Bytes()),
+			},
+			Events: []*Event{{ID: "3"}},
+		},
+		{
+			Name: "max age and count",
+			Config: &MemoryEventStoreConfig{
+				NumEventsToKeep: 1,
+				MaxAge:          time.Hour,
+			},
+			Events: []*Event{{ID: "3"}},
+		},
+	} {
+		c := &testClock{}
+		v.Config.Clock = c
+		s := NewMemoryEventStoreFromConfig(v.Config)
+		for _, e := range []*Event{{ID: "1"}, {ID: "2"}, {ID: "3"}} {
+			s.Append(e)
+			s.Trim()
+			c.Advance(time.Second)
+		}
+		events, err := s.Since("")
+		if err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if !reflect.DeepEqual(events, v.Events) {
+			t.Fatalf("%s: %+v != %+v", v.Name, events, v.Events)
+		}
+	}
+}
+
+func TestMemoryEventStoreTTL(t *testing.T) {
+	var (
+		c = &testClock{}
+		s = NewMemoryEventStoreFromConfig(&MemoryEventStoreConfig{
+			NumEventsToKeep: 10,
+			Clock:           c,
+		})
+	)
+	for _, e := range []*Event{
+		{ID: "1", TTL: 2 * time.Second},
+		{ID: "2"},
+		{ID: "3", TTL: 1500 * time.Millisecond},
+	} {
+		s.Append(e)
+		s.Trim()
+		c.Advance(time.Second)
+	}
+	c.Advance(time.Second)
+	events, err := s.Since("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := []*Event{{ID: "2"}}; !reflect.DeepEqual(events, v) {
+		t.Fatalf("%+v != %+v", events, v)
+	}
+	if _, err := s.Since("1"); err != ErrEventNotFound {
+		t.Fatalf("%#v != %#v", err, ErrEventNotFound)
+	}
+	events, err = s.Since("3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+}
+
+func TestMemoryEventStoreGrowth(t *testing.T) {
+	s := NewMemoryEventStore(10)
+	for i := 0; i < 10000; i++ {
+		s.Append(&Event{ID: strconv.Itoa(i)})
+		s.Trim()
+	}
+	if n := len(s.events); n != 10 {
+		t.Fatalf("%d != %d", n, 10)
+	}
+	if c := cap(s.events); c > 100 {
+		t.Fatalf("capacity %d exceeds %d", c, 100)
+	}
+	events, err := s.Since("9990")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 9 || events[8].ID != "9999" {
+		t.Fatalf("unexpected events %v", events)
+	}
+}
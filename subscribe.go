@@ -0,0 +1,127 @@
+package sse
+
+import (
+	"sync"
+	"time"
+)
+
+// defaultSubscriberBufferSize is used when SubscriberBufferSize is not set.
+const defaultSubscriberBufferSize = 64
+
+// Subscribe returns a channel that receives the events sent to all clients
+// (in the stream with an empty key) for which filter returns true, allowing
+// in-process consumers to observe the same events as HTTP clients without
+// making a request. A nil filter receives every event. The subscriber buffers
+// up to SubscriberBufferSize events, is disconnected if it falls further
+// behind, and appears in Connections but does not count toward the connection
+// limits of a Handler. The channel is closed when the returned function is
+// called, the subscriber falls too far behind, or the stream is closed with
+// CloseStream. Events received must not be modified.
+func (b *Broker) Subscribe(filter func(*Event) bool) (<-chan *Event, func()) {
+	return b.SubscribeFrom("", filter)
+}
+
+// SubscribeFrom is like Subscribe but first delivers the stored events after
+// the one with the provided ID, as if a client had reconnected with it as the
+// Last-Event-ID. If the ID is not found, all stored events are delivered.
+func (b *Broker) SubscribeFrom(lastEventID string, filter func(*Event) bool) (<-chan *Event, func()) {
+	bufferSize := b.cfg.SubscriberBufferSize
+	if bufferSize <= 0 {
+		bufferSize = defaultSubscriberBufferSize
+	}
+	var (
+		eventChan = make(chan *Event)
+		doneChan  = make(chan struct{})
+		closeOnce sync.Once
+		conn      = &connection{
+			id:          b.nextConnID(),
+			connectedAt: time.Now(),
+			topics:      make(map[string]struct{}),
+			buffer:      newRingBuffer(bufferSize),
+			terminate:   func() {},
+			cfg:         &HandlerConfig{ChannelBufferSize: bufferSize},
+			subscriber:  true,
+		}
+		events []*Event
+	)
+
+	// Register the connection and read the stored events at the same time so
+	// that no event is missed or delivered twice
+	func() {
+		defer b.mutex.Unlock()
+		b.mutex.Lock()
+		b.addConnection(conn)
+		if lastEventID == "" || b.cfg.DisableReplay {
+			return
+		}
+		s := b.storeFor("")
+		var err error
+		events, err = s.Since(lastEventID)
+		if err == ErrEventNotFound {
+			events, _ = s.Since("")
+		}
+	}()
+
+	send := func(e *Event) bool {
+		if filter != nil && !filter(e) {
+			return true
+		}
+		select {
+		case eventChan <- e:
+			return true
+		case <-doneChan:
+			return false
+		}
+	}
+	go func() {
+
+		// Remove the connection and release any events that will not be
+		// delivered before closing the channel
+		defer func() {
+			func() {
+				defer b.mutex.Unlock()
+				b.mutex.Lock()
+				b.closeConnection(conn, DisconnectClientClosed)
+			}()
+			for {
+				e, _ := conn.buffer.pop()
+				if e == nil {
+					break
+				}
+				e.markWritten()
+			}
+			close(eventChan)
+		}()
+		for _, e := range events {
+			if conn.wants(e) && !send(e) {
+				return
+			}
+		}
+		for {
+			if e := conn.shedEvent(); e != nil && !send(e) {
+				return
+			}
+			e, ok := conn.buffer.pop()
+			if e != nil {
+				e.markWritten()
+				if !send(e) {
+					return
+				}
+				continue
+			}
+			if !ok {
+				return
+			}
+			select {
+			case <-conn.buffer.readyChan:
+			case <-doneChan:
+				return
+			}
+		}
+	}()
+	return eventChan, func() {
+		closeOnce.Do(func() {
+			close(doneChan)
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package sse
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestBrokerSubscribe(t *testing.T) {
+	b := NewBroker(&BrokerConfig{
+		NumEventsToKeep:      10,
+		SubscriberBufferSize: 4,
+	})
+	b.Send(&Event{ID: "1"})
+	b.Send(&Event{ID: "2", Type: "skip"})
+	b.Send(&Event{ID: "3"})
+	filter := func(e *Event) bool {
+		return e.Type != "skip"
+	}
+	var (
+		liveChan, liveCancel     = b.Subscribe(filter)
+		replayChan, replayCancel = b.SubscribeFrom("1", filter)
+	)
+	defer liveCancel()
+	defer replayCancel()
+	b.Send(&Event{ID: "4", Type: "skip"})
+	b.Send(&Event{ID: "5"})
+	for _, v := range []struct {
+		Name      string
+		EventChan <-chan *Event
+		IDs       []string
+	}{
+		{
+			Name:      "live",
+			EventChan: liveChan,
+			IDs:       []string{"5"},
+		},
+		{
+			Name:      "replay",
+			EventChan: replayChan,
+			IDs:       []string{"3", "5"},
+		},
+	} {
+		for _, id := range v.IDs {
+			select {
+			case e := <-v.EventChan:
+				if e.ID != id {
+					t.Fatalf("%s: %#v != %#v", v.Name, e.ID, id)
+				}
+			case <-time.After(CLIENT_DELAY):
+				t.Fatalf("%s: timeout waiting for event", v.Name)
+			}
+		}
+	}
+
+	// Canceling one subscription and closing the stream must close the
+	// channels
+	liveCancel()
+	b.CloseStream("")
+	for _, c := range []<-chan *Event{liveChan, replayChan} {
+		select {
+		case _, ok := <-c:
+			if ok {
+				t.Fatal("unexpected event")
+			}
+		case <-time.After(CLIENT_DELAY):
+			t.Fatal("channel was not closed")
+		}
+	}
+}
+
+func TestHandlerSubscribe(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		ChannelBufferSize: 4,
+	})
+	defer h.Close()
+	eventChan, cancel := h.Subscribe(nil)
+	defer cancel()
+	h.Send(&Event{ID: "1"})
+	select {
+	case e := <-eventChan:
+		if e.ID != "1" {
+			t.Fatalf("%#v != %#v", e.ID, "1")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+}
+
+func TestHandlerSubscribeLimits(t *testing.T) {
+	h := NewHandler(&HandlerConfig{
+		MaxConnections: 1,
+	})
+	defer h.Close()
+	_, cancel := h.Subscribe(nil)
+	defer cancel()
+
+	// The subscriber must not prevent a client from connecting
+	ctx, cancelCtx := context.WithCancel(context.Background())
+	cancelCtx()
+	var (
+		w = httptest.NewRecorder()
+		r = httptest.NewRequest(http.MethodGet, "/", nil).WithContext(ctx)
+	)
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%#v != %#v", w.Code, http.StatusOK)
+	}
+}
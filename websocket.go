@@ -0,0 +1,280 @@
+package sse
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+const (
+	defaultWebSocketProtocol = "sse"
+
+	defaultMaxWebSocketFrameSize = 1024 * 1024
+
+	webSocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xa
+
+	// control frames are identified by the high bit of the opcode and may
+	// not have a payload larger than this
+	wsOpControl           = 0x8
+	wsMaxControlFrameSize = 125
+
+	wsCloseProtocolError = 1002
+	wsCloseMessageTooBig = 1009
+)
+
+var (
+	errWebSocketHandshake = errors.New("invalid WebSocket handshake response")
+	errWebSocketFrame     = errors.New("invalid WebSocket frame")
+	errWebSocketTooLarge  = errors.New("WebSocket frame exceeds maximum size")
+)
+
+// webSocketAccept computes the expected value of the Sec-WebSocket-Accept
+// header for the provided key.
+func webSocketAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + webSocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// wsConn reads the payloads of data messages from a WebSocket connection as a
+// continuous stream, answering pings and close frames as they are received.
+type wsConn struct {
+	mutex     sync.Mutex
+	conn      io.ReadWriteCloser
+	reader    *bufio.Reader
+	maxSize   uint64
+	remaining uint64
+	mask      []byte
+	maskIdx   int
+
+	// doneChan is closed by Close to stop the goroutine that closes the
+	// connection when the context is done, since the body of an upgraded
+	// response is not closed by canceling the request
+	doneChan  chan struct{}
+	closeOnce sync.Once
+}
+
+func (w *wsConn) writeFrame(opcode byte, payload []byte) error {
+	defer w.mutex.Unlock()
+	w.mutex.Lock()
+	b := []byte{0x80 | opcode}
+	switch l := len(payload); {
+	case l < 126:
+		b = append(b, 0x80|byte(l))
+	case l <= 0xffff:
+		b = append(b, 0x80|126, 0, 0)
+		binary.BigEndian.PutUint16(b[2:], uint16(l))
+	default:
+		b = append(b, 0x80|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(b[2:], uint64(l))
+	}
+	mask := make([]byte, 4)
+	if _, err := rand.Read(mask); err != nil {
+		return err
+	}
+	b = append(b, mask...)
+	for i, v := range payload {
+		b = append(b, v^mask[i%4])
+	}
+	_, err := w.conn.Write(b)
+	return err
+}
+
+// closeWithCode sends a close frame with the provided status code.
+func (w *wsConn) closeWithCode(code uint16) {
+	b := make([]byte, 2)
+	binary.BigEndian.PutUint16(b, code)
+	w.writeFrame(wsOpClose, b)
+}
+
+// readHeader reads the next frame header, returning its opcode. Control frames
+// that are fragmented or too large and data frames larger than maxSize cause
+// the connection to be closed with the appropriate status code.
+func (w *wsConn) readHeader() (byte, error) {
+	h := make([]byte, 2)
+	if _, err := io.ReadFull(w.reader, h); err != nil {
+		return 0, err
+	}
+	var (
+		opcode = h[0] & 0x0f
+		length = uint64(h[1] & 0x7f)
+	)
+	switch length {
+	case 126:
+		b := make([]byte, 2)
+		if _, err := io.ReadFull(w.reader, b); err != nil {
+			return 0, err
+		}
+		length = uint64(binary.BigEndian.Uint16(b))
+	case 127:
+		b := make([]byte, 8)
+		if _, err := io.ReadFull(w.reader, b); err != nil {
+			return 0, err
+		}
+		length = binary.BigEndian.Uint64(b)
+	}
+	if opcode&wsOpControl != 0 {
+		if h[0]&0x80 == 0 || length > wsMaxControlFrameSize {
+			w.closeWithCode(wsCloseProtocolError)
+			return 0, errWebSocketFrame
+		}
+	} else if length > w.maxSize {
+		w.closeWithCode(wsCloseMessageTooBig)
+		return 0, errWebSocketTooLarge
+	}
+	w.mask = nil
+	w.maskIdx = 0
+	if h[1]&0x80 != 0 {
+		w.mask = make([]byte, 4)
+		if _, err := io.ReadFull(w.reader, w.mask); err != nil {
+			return 0, err
+		}
+	}
+	w.remaining = length
+	return opcode, nil
+}
+
+// readPayload reads the remainder of the current frame's payload.
+func (w *wsConn) readPayload() ([]byte, error) {
+	b := make([]byte, w.remaining)
+	n, err := io.ReadFull(w, b)
+	return b[:n], err
+}
+
+func (w *wsConn) Read(p []byte) (int, error) {
+	for w.remaining == 0 {
+		opcode, err := w.readHeader()
+		if err != nil {
+			return 0, err
+		}
+		switch opcode {
+		case wsOpContinuation, wsOpText, wsOpBinary:
+		case wsOpPing:
+			payload, err := w.readPayload()
+			if err != nil {
+				return 0, err
+			}
+			if err := w.writeFrame(wsOpPong, payload); err != nil {
+				return 0, err
+			}
+		case wsOpPong:
+			if _, err := w.readPayload(); err != nil {
+				return 0, err
+			}
+		case wsOpClose:
+			w.writeFrame(wsOpClose, nil)
+			return 0, io.EOF
+		default:
+			return 0, errWebSocketFrame
+		}
+	}
+	if uint64(len(p)) > w.remaining {
+		p = p[:w.remaining]
+	}
+	n, err := w.reader.Read(p)
+	if w.mask != nil {
+		for i := 0; i < n; i++ {
+			p[i] ^= w.mask[w.maskIdx%4]
+			w.maskIdx++
+		}
+	}
+	w.remaining -= uint64(n)
+	return n, err
+}
+
+func (w *wsConn) Close() error {
+	w.closeOnce.Do(func() {
+		close(w.doneChan)
+	})
+	w.writeFrame(wsOpClose, nil)
+	return w.conn.Close()
+}
+
+// dialWebSocket performs the WebSocket opening handshake and returns the
+// payloads of the messages received as a single stream.
+func (c *Client) dialWebSocket(ctx context.Context) (io.ReadCloser, error) {
+	u := *c.webSocketURL
+	switch u.Scheme {
+	case "ws":
+		u.Scheme = "http"
+	case "wss":
+		u.Scheme = "https"
+	}
+	req := c.cfg.Request.Clone(ctx)
+	req.Method = http.MethodGet
+	req.Body = nil
+	req.URL = &u
+	req.Host = ""
+	c.setHeaders(req)
+	keyBytes := make([]byte, 16)
+	if _, err := rand.Read(keyBytes); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(keyBytes)
+	req.Header.Del("Accept")
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	req.Header.Set("Sec-WebSocket-Version", "13")
+	req.Header.Set("Sec-WebSocket-Key", key)
+	req.Header.Set("Sec-WebSocket-Protocol", c.cfg.WebSocketProtocol)
+	r, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if c.cfg.OnResponse != nil {
+		c.cfg.OnResponse(r)
+	}
+	if r.StatusCode != http.StatusSwitchingProtocols {
+		r.Body.Close()
+		return nil, fmt.Errorf("unexpected status code %d", r.StatusCode)
+	}
+	// The server must accept the requested subprotocol (RFC 6455 §4.1)
+	conn, ok := r.Body.(io.ReadWriteCloser)
+	if !ok || r.Header.Get("Sec-WebSocket-Accept") != webSocketAccept(key) ||
+		r.Header.Get("Sec-WebSocket-Protocol") != c.cfg.WebSocketProtocol {
+		r.Body.Close()
+		return nil, errWebSocketHandshake
+	}
+	w := &wsConn{
+		conn:     conn,
+		reader:   bufio.NewReader(conn),
+		maxSize:  uint64(c.cfg.MaxWebSocketFrameSize),
+		doneChan: make(chan struct{}),
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-w.doneChan:
+		}
+	}()
+	return w, nil
+}
+
+func parseWebSocketURL(rawURL string) (*url.URL, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "ws", "wss", "http", "https":
+		return u, nil
+	}
+	return nil, fmt.Errorf("unsupported WebSocket scheme %#v", u.Scheme)
+}
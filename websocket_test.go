@@ -0,0 +1,299 @@
+package sse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestFrame(w io.Writer, fin bool, opcode byte, payload string) {
+	b := opcode
+	if fin {
+		b |= 0x80
+	}
+	w.Write(append([]byte{b, byte(len(payload))}, payload...))
+}
+
+func readTestFrame(r *bufio.Reader) (byte, []byte, error) {
+	h := make([]byte, 6)
+	if _, err := io.ReadFull(r, h); err != nil {
+		return 0, nil, err
+	}
+	payload := make([]byte, h[1]&0x7f)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= h[2+i%4]
+	}
+	return h[0] & 0x0f, payload, nil
+}
+
+func TestClientWebSocketFallback(t *testing.T) {
+	var (
+		lastIDChan = make(chan string, 1)
+		pongChan   = make(chan []byte, 1)
+	)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case lastIDChan <- r.Header.Get("Last-Event-ID"):
+		default:
+		}
+		if r.Header.Get("Sec-WebSocket-Protocol") != defaultWebSocketProtocol {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Protocol: " + defaultWebSocketProtocol + "\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " +
+			webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		writeTestFrame(rw, true, wsOpPing, "ping")
+		writeTestFrame(rw, false, wsOpText, "id:1\ndata:")
+		writeTestFrame(rw, true, wsOpContinuation, "test\n\n")
+		rw.Flush()
+		opcode, payload, err := readTestFrame(rw.Reader)
+		if err == nil && opcode == wsOpPong {
+			pongChan <- payload
+		}
+		writeTestFrame(rw, true, wsOpClose, "")
+		rw.Flush()
+		readTestFrame(rw.Reader)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:              []string{s.URL + "/sse"},
+		LastEventID:       "0",
+		WebSocketURL:      "ws" + strings.TrimPrefix(s.URL, "http") + "/ws",
+		FallbackThreshold: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	select {
+	case e := <-c.Events:
+		if e.Data != "test" || e.ID != "1" {
+			t.Fatalf("unexpected event: %+v", e)
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+	select {
+	case p := <-pongChan:
+		if !bytes.Equal(p, []byte("ping")) {
+			t.Fatalf("%#v != %#v", string(p), "ping")
+		}
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for pong")
+	}
+	if v := <-lastIDChan; v != "0" {
+		t.Fatalf("%#v != %#v", v, "0")
+	}
+}
+
+func TestClientWebSocketProtocol(t *testing.T) {
+	for _, v := range []struct {
+		Name     string
+		Protocol string
+		Accepted bool
+	}{
+		{
+			Name:     "accepted",
+			Protocol: defaultWebSocketProtocol,
+			Accepted: true,
+		},
+		{
+			Name: "missing",
+		},
+		{
+			Name:     "different",
+			Protocol: "other",
+		},
+	} {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		})
+		mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+			conn, rw, err := w.(http.Hijacker).Hijack()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+			rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+			if v.Protocol != "" {
+				rw.WriteString("Sec-WebSocket-Protocol: " + v.Protocol + "\r\n")
+			}
+			rw.WriteString("Sec-WebSocket-Accept: " +
+				webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+			writeTestFrame(rw, true, wsOpText, "data:test\n\n")
+			writeTestFrame(rw, true, wsOpClose, "")
+			rw.Flush()
+			readTestFrame(rw.Reader)
+		})
+		s := httptest.NewServer(mux)
+		c, err := NewClientFromConfig(&ClientConfig{
+			URLs:              []string{s.URL + "/sse"},
+			WebSocketURL:      "ws" + strings.TrimPrefix(s.URL, "http") + "/ws",
+			FallbackThreshold: 1,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var accepted bool
+		select {
+		case <-c.Events:
+			accepted = true
+		case <-time.After(CLIENT_DELAY / 2):
+		}
+		c.Close()
+		s.Close()
+		if accepted != v.Accepted {
+			t.Fatalf("%s: %#v != %#v", v.Name, accepted, v.Accepted)
+		}
+	}
+}
+
+func TestClientWebSocketClose(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/sse", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+		rw.WriteString("Upgrade: websocket\r\nConnection: Upgrade\r\n")
+		rw.WriteString("Sec-WebSocket-Protocol: " + defaultWebSocketProtocol + "\r\n")
+		rw.WriteString("Sec-WebSocket-Accept: " +
+			webSocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		writeTestFrame(rw, true, wsOpText, "data:test\n\n")
+		rw.Flush()
+		readTestFrame(rw.Reader)
+	})
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	c, err := NewClientFromConfig(&ClientConfig{
+		URLs:              []string{s.URL + "/sse"},
+		WebSocketURL:      "ws" + strings.TrimPrefix(s.URL, "http") + "/ws",
+		FallbackThreshold: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-c.Events:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("timeout waiting for event")
+	}
+
+	// Closing the client must interrupt the idle connection
+	doneChan := make(chan any)
+	go func() {
+		defer close(doneChan)
+		c.Close()
+	}()
+	select {
+	case <-doneChan:
+	case <-time.After(CLIENT_DELAY):
+		t.Fatal("Close blocked on an idle WebSocket connection")
+	}
+}
+
+type testWebSocketConn struct {
+	io.Reader
+	bytes.Buffer
+}
+
+func (c *testWebSocketConn) Read(p []byte) (int, error) {
+	return c.Reader.Read(p)
+}
+
+func (c *testWebSocketConn) Close() error {
+	return nil
+}
+
+func TestWebSocketInvalidFrames(t *testing.T) {
+	for _, v := range []struct {
+		Name  string
+		Input []byte
+		Err   error
+		Code  uint16
+	}{
+		{
+			Name:  "valid frame",
+			Input: append([]byte{0x81, 4}, "data"...),
+		},
+		{
+			Name:  "fragmented control frame",
+			Input: []byte{wsOpPing, 0},
+			Err:   errWebSocketFrame,
+			Code:  wsCloseProtocolError,
+		},
+		{
+			Name:  "oversized control frame",
+			Input: append([]byte{0x80 | wsOpPing, 126, 0, 126}, make([]byte, 126)...),
+			Err:   errWebSocketFrame,
+			Code:  wsCloseProtocolError,
+		},
+		{
+			Name:  "oversized data frame",
+			Input: append([]byte{0x81, 17}, make([]byte, 17)...),
+			Err:   errWebSocketTooLarge,
+			Code:  wsCloseMessageTooBig,
+		},
+		{
+			Name:  "huge data frame",
+			Input: []byte{0x81, 127, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			Err:   errWebSocketTooLarge,
+			Code:  wsCloseMessageTooBig,
+		},
+	} {
+		var (
+			c = &testWebSocketConn{Reader: bytes.NewReader(v.Input)}
+			w = &wsConn{
+				conn:    c,
+				reader:  bufio.NewReader(c),
+				maxSize: 16,
+			}
+		)
+		_, err := w.Read(make([]byte, 32))
+		if err != v.Err {
+			t.Fatalf("%s: %v != %v", v.Name, err, v.Err)
+		}
+		if v.Code == 0 {
+			continue
+		}
+		opcode, payload, err := readTestFrame(bufio.NewReader(&c.Buffer))
+		if err != nil {
+			t.Fatalf("%s: %s", v.Name, err)
+		}
+		if opcode != wsOpClose || len(payload) != 2 {
+			t.Fatalf("%s: unexpected frame %#v %#v", v.Name, opcode, payload)
+		}
+		if code := binary.BigEndian.Uint16(payload); code != v.Code {
+			t.Fatalf("%s: %v != %v", v.Name, code, v.Code)
+		}
+	}
+}